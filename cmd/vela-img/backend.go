@@ -0,0 +1,535 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// backendImg builds the image with img.
+	backendImg = "img"
+	// backendBuildctl builds the image with a rootless BuildKit daemon.
+	backendBuildctl = "buildctl"
+	// backendKaniko builds the image with kaniko.
+	backendKaniko = "kaniko"
+)
+
+const (
+	// _buildctl is the path to the BuildKit client in the image.
+	_buildctl = "/usr/bin/buildctl"
+	// _buildctlDaemonless is the path to the script running
+	// the BuildKit client with a temporary daemon in the image.
+	_buildctlDaemonless = "/usr/bin/buildctl-daemonless.sh"
+	// _kaniko is the path to the kaniko executor in the image.
+	_kaniko = "/kaniko/executor"
+)
+
+// backend represents the interface for a tool building the image.
+type backend interface {
+	// Command formats the command building the image from the Build.
+	Command(b *Build) *exec.Cmd
+	// Digest returns the manifest digest for the image built from the Build.
+	Digest(ctx context.Context, b *Build) (string, error)
+	// Name returns the name of the backend.
+	Name() string
+	// Publishes checks if the image is published by the build command
+	// instead of a separate push command after the build.
+	Publishes() bool
+	// Save writes the image built from the Build to the archive
+	// when the archive is not already written by the build command.
+	Save(ctx context.Context, b *Build) error
+	// Validate verifies the Build only uses features supported by the backend.
+	Validate(b *Build) error
+	// Version formats the command outputting the version of the backend.
+	Version(i *Img) *exec.Cmd
+}
+
+// newBackend returns the backend for the provided name.
+func newBackend(name string) (backend, error) {
+	switch name {
+	case "", backendImg:
+		return new(imgBackend), nil
+	case backendBuildctl:
+		return new(buildctlBackend), nil
+	case backendKaniko:
+		return new(kanikoBackend), nil
+	default:
+		return nil, fmt.Errorf("invalid build backend provided: %s", name)
+	}
+}
+
+// imgBackend builds the image with img.
+type imgBackend struct{}
+
+// Command formats the img build command from the Build.
+func (*imgBackend) Command(b *Build) *exec.Cmd {
+	logrus.Trace("creating img build command from plugin configuration")
+
+	// variable to store flags for command
+	var flags []string
+
+	// add flag for each BuildArgs from provided build command
+	for _, arg := range b.AllBuildArgs() {
+		flags = append(flags, fmt.Sprintf("--build-arg=%s", arg))
+	}
+
+	// add flag for each CacheFrom from provided build command
+	for _, cache := range b.CacheFrom {
+		flags = append(flags, fmt.Sprintf("--cache-from=%s", cache))
+	}
+
+	// check if File is provided
+	if len(b.File) > 0 {
+		// add flag for File from provided build command
+		flags = append(flags, fmt.Sprintf("-f=%s", b.File))
+	}
+
+	// add flag for each Labels from provided build command
+	for _, label := range b.AllLabels() {
+		flags = append(flags, fmt.Sprintf("--label=%s", label))
+	}
+
+	// check if NoCache is provided
+	if b.NoCache {
+		// add flag for NoCache from provided build command
+		flags = append(flags, "--no-cache")
+	}
+
+	// check if NoConsole is provided
+	if b.NoConsole {
+		// add flag for NoConsole from provided build command
+		flags = append(flags, "--no-console")
+	}
+
+	// check if Output is provided
+	if len(b.Output) > 0 {
+		// add flag for Output from provided build command
+		flags = append(flags, fmt.Sprintf("--output=%s", b.Output))
+	}
+
+	// check if Platforms is provided
+	if len(b.Platforms) > 0 {
+		// add flag for Platforms from provided build command
+		flags = append(flags, fmt.Sprintf("--platform=%s", strings.Join(b.Platforms, ",")))
+	}
+
+	// add flag for each mounted secret from provided build command
+	for _, s := range b.secrets {
+		flags = append(flags, s.Flag())
+	}
+
+	// check if an SSH agent is provided
+	if len(b.socket) > 0 {
+		// add flag for SSH from provided build command
+		flags = append(flags, fmt.Sprintf("--ssh=default=%s", b.socket))
+	}
+
+	// add flag for each Tags from provided build command
+	for _, tag := range b.AllTags() {
+		flags = append(flags, fmt.Sprintf("-t=%s", tag))
+	}
+
+	// check if Target is provided
+	if len(b.Target) > 0 {
+		// add flag for Target from provided build command
+		flags = append(flags, fmt.Sprintf("--target=%s", b.Target))
+	}
+
+	// add the required directory param
+	flags = append(flags, b.Directory)
+
+	return b.Img.Command(append([]string{buildAction}, flags...)...)
+}
+
+// Digest returns the digest for the image from the images stored by img.
+func (*imgBackend) Digest(ctx context.Context, b *Build) (string, error) {
+	// check if the image is stored by img
+	if len(b.Output) > 0 {
+		return "", nil
+	}
+
+	out, err := b.Img.Run(ctx, b.Img.Command(listAction))
+	if err != nil {
+		return "", err
+	}
+
+	return listDigest(out, b.AllTags()[0])
+}
+
+// Name returns the name of the img backend.
+func (*imgBackend) Name() string {
+	return backendImg
+}
+
+// Publishes returns false since img stores the image locally.
+func (*imgBackend) Publishes() bool {
+	return false
+}
+
+// Save writes the image stored by img to the archive for the Build.
+func (*imgBackend) Save(ctx context.Context, b *Build) error {
+	// check if an archive is created
+	if len(b.archive) == 0 {
+		return nil
+	}
+
+	_, err := b.Img.Run(ctx, b.Img.Command(saveAction, fmt.Sprintf("--output=%s", b.archive), b.AllTags()[0]))
+
+	return err
+}
+
+// Validate verifies the Build only uses features supported by img.
+func (*imgBackend) Validate(b *Build) error {
+	// verify cache sources are images
+	for _, cache := range b.CacheFrom {
+		if isSpec(cache) {
+			return fmt.Errorf("build cache_from %s is not supported by the %s backend", cache, backendImg)
+		}
+	}
+
+	// verify the cache is not exported
+	if len(b.CacheTo) > 0 || b.AutoCache {
+		return fmt.Errorf("build cache_to is not supported by the %s backend", backendImg)
+	}
+
+	return nil
+}
+
+// Version formats the img version command.
+func (*imgBackend) Version(i *Img) *exec.Cmd {
+	return versionCmd(i)
+}
+
+// buildctlBackend builds the image with the BuildKit
+// client running a temporary rootless daemon.
+type buildctlBackend struct{}
+
+// Command formats the buildctl build command from the Build.
+func (*buildctlBackend) Command(b *Build) *exec.Cmd {
+	logrus.Trace("creating buildctl build command from plugin configuration")
+
+	// variable to store the directory containing the Dockerfile
+	dockerfile := b.Directory
+
+	// variable to store flags for command
+	flags := []string{"--frontend=dockerfile.v0"}
+
+	// add flag for the build context from provided build command
+	flags = append(flags, fmt.Sprintf("--local=context=%s", b.Directory))
+
+	// check if File is provided
+	if len(b.File) > 0 {
+		dockerfile = filepath.Dir(b.File)
+
+		// add flag for File from provided build command
+		flags = append(flags, fmt.Sprintf("--opt=filename=%s", filepath.Base(b.File)))
+	}
+
+	// add flag for the Dockerfile directory from provided build command
+	flags = append(flags, fmt.Sprintf("--local=dockerfile=%s", dockerfile))
+
+	// add flag for each BuildArgs from provided build command
+	for _, arg := range b.AllBuildArgs() {
+		flags = append(flags, fmt.Sprintf("--opt=build-arg:%s", arg))
+	}
+
+	// add flag for each Labels from provided build command
+	for _, label := range b.AllLabels() {
+		flags = append(flags, fmt.Sprintf("--opt=label:%s", label))
+	}
+
+	// check if Platforms is provided
+	if len(b.Platforms) > 0 {
+		// add flag for Platforms from provided build command
+		flags = append(flags, fmt.Sprintf("--opt=platform=%s", strings.Join(b.Platforms, ",")))
+	}
+
+	// check if Target is provided
+	if len(b.Target) > 0 {
+		// add flag for Target from provided build command
+		flags = append(flags, fmt.Sprintf("--opt=target=%s", b.Target))
+	}
+
+	// add flag for each CacheFrom from provided build command
+	for _, cache := range b.AllCacheFrom() {
+		flags = append(flags, fmt.Sprintf("--import-cache=%s", cache))
+	}
+
+	// add flag for each CacheTo from provided build command
+	for _, cache := range b.AllCacheTo() {
+		flags = append(flags, fmt.Sprintf("--export-cache=%s", cache))
+	}
+
+	// check if NoCache is provided
+	if b.NoCache {
+		// add flag for NoCache from provided build command
+		flags = append(flags, "--no-cache")
+	}
+
+	// check if NoConsole is provided
+	if b.NoConsole {
+		// add flag for NoConsole from provided build command
+		flags = append(flags, "--progress=plain")
+	}
+
+	// check if Output is provided
+	if len(b.Output) > 0 {
+		// add flag for Output from provided build command
+		flags = append(flags, fmt.Sprintf("--output=%s", b.Output))
+	} else {
+		// add flag for the image with every tag from provided build command
+		output := fmt.Sprintf("--output=type=image,\"name=%s\",push=%t",
+			strings.Join(b.AllTags(), ","), b.publish)
+
+		// check if the image is published over http
+		if b.insecure {
+			output += ",registry.insecure=true"
+		}
+
+		flags = append(flags, output)
+	}
+
+	// check if an archive is created
+	if len(b.archive) > 0 {
+		// add flag for the archive with the image from provided build command
+		flags = append(flags, fmt.Sprintf("--output=type=docker,dest=%s", b.archive))
+	}
+
+	// add flag for each mounted secret from provided build command
+	for _, s := range b.secrets {
+		flags = append(flags, s.Flag())
+	}
+
+	// check if an SSH agent is provided
+	if len(b.socket) > 0 {
+		// add flag for SSH from provided build command
+		flags = append(flags, fmt.Sprintf("--ssh=default=%s", b.socket))
+	}
+
+	// check if a digest file is created
+	if len(b.digestFile) > 0 {
+		// add flag for the digest file from provided build command
+		flags = append(flags, fmt.Sprintf("--metadata-file=%s", b.digestFile))
+	}
+
+	// nolint:gosec // this functionality is not exploitable the way
+	// the plugin accepts configuration
+	return exec.Command(_buildctlDaemonless, append([]string{buildAction}, flags...)...)
+}
+
+// Digest returns the digest for the image from the metadata file written by BuildKit.
+func (*buildctlBackend) Digest(ctx context.Context, b *Build) (string, error) {
+	// check if the image is output
+	if len(b.Output) > 0 {
+		return "", nil
+	}
+
+	return metadataDigest(b.digestFile)
+}
+
+// Name returns the name of the buildctl backend.
+func (*buildctlBackend) Name() string {
+	return backendBuildctl
+}
+
+// Publishes returns true since BuildKit publishes the image with the output.
+func (*buildctlBackend) Publishes() bool {
+	return true
+}
+
+// Save returns nil since BuildKit writes the archive with the build.
+func (*buildctlBackend) Save(ctx context.Context, b *Build) error {
+	return nil
+}
+
+// Validate verifies the Build for BuildKit which supports every feature.
+func (*buildctlBackend) Validate(b *Build) error {
+	return nil
+}
+
+// Version formats the buildctl version command.
+func (*buildctlBackend) Version(i *Img) *exec.Cmd {
+	return exec.Command(_buildctl, "--version")
+}
+
+// kanikoBackend builds the image with kaniko.
+type kanikoBackend struct{}
+
+// Command formats the kaniko executor command from the Build.
+func (*kanikoBackend) Command(b *Build) *exec.Cmd {
+	logrus.Trace("creating kaniko build command from plugin configuration")
+
+	// variable to store flags for command
+	var flags []string
+
+	// add flag for the build context from provided build command
+	flags = append(flags, fmt.Sprintf("--context=%s", b.Directory))
+
+	// check if File is provided
+	if len(b.File) > 0 {
+		// add flag for File from provided build command
+		flags = append(flags, fmt.Sprintf("--dockerfile=%s", b.File))
+	}
+
+	// add flag for each BuildArgs from provided build command
+	for _, arg := range b.AllBuildArgs() {
+		flags = append(flags, fmt.Sprintf("--build-arg=%s", arg))
+	}
+
+	// add flag for each Labels from provided build command
+	for _, label := range b.AllLabels() {
+		flags = append(flags, fmt.Sprintf("--label=%s", label))
+	}
+
+	// check if Platforms is provided
+	if len(b.Platforms) > 0 {
+		// add flag for Platforms from provided build command
+		flags = append(flags, fmt.Sprintf("--custom-platform=%s", b.Platforms[0]))
+	}
+
+	// check if Target is provided
+	if len(b.Target) > 0 {
+		// add flag for Target from provided build command
+		flags = append(flags, fmt.Sprintf("--target=%s", b.Target))
+	}
+
+	// check if the cache should be used
+	if len(b.CacheTo) > 0 || b.AutoCache {
+		// add flag for the cache from provided build command
+		flags = append(flags, "--cache=true")
+	}
+
+	// check if CacheTo is provided
+	if len(b.CacheTo) > 0 {
+		// add flag for CacheTo from provided build command
+		flags = append(flags, fmt.Sprintf("--cache-repo=%s", specFields(cacheSpec(b.CacheTo[0]))["ref"]))
+	}
+
+	// check if Output is provided
+	if len(b.Output) > 0 {
+		// add flag for Output from provided build command
+		flags = append(flags, fmt.Sprintf("--tar-path=%s", tarPath(b.Output)))
+	}
+
+	// check if an archive is created
+	if len(b.archive) > 0 {
+		// add flag for the archive with the image from provided build command
+		flags = append(flags, fmt.Sprintf("--tar-path=%s", b.archive))
+	}
+
+	// add flag for each Tags from provided build command
+	for _, tag := range b.AllTags() {
+		flags = append(flags, fmt.Sprintf("--destination=%s", tag))
+	}
+
+	// check if the image is published
+	if !b.publish {
+		// add flag for skipping the push from provided build command
+		flags = append(flags, "--no-push")
+	}
+
+	// check if the image is published over http
+	if b.insecure {
+		// add flag for the insecure registry from provided build command
+		flags = append(flags, "--insecure")
+	}
+
+	// check if a digest file is created
+	if len(b.digestFile) > 0 {
+		// add flag for the digest file from provided build command
+		flags = append(flags, fmt.Sprintf("--digest-file=%s", b.digestFile))
+	}
+
+	// nolint:gosec // this functionality is not exploitable the way
+	// the plugin accepts configuration
+	return exec.Command(_kaniko, flags...)
+}
+
+// Digest returns the digest for the image from the digest file written by kaniko.
+func (*kanikoBackend) Digest(ctx context.Context, b *Build) (string, error) {
+	return fileDigest(b.digestFile)
+}
+
+// Name returns the name of the kaniko backend.
+func (*kanikoBackend) Name() string {
+	return backendKaniko
+}
+
+// Publishes returns true since kaniko publishes the image to every destination.
+func (*kanikoBackend) Publishes() bool {
+	return true
+}
+
+// Save returns nil since kaniko writes the archive with the build.
+func (*kanikoBackend) Save(ctx context.Context, b *Build) error {
+	return nil
+}
+
+// Validate verifies the Build only uses features supported by kaniko.
+func (*kanikoBackend) Validate(b *Build) error {
+	// verify cache sources are not provided
+	if len(b.CacheFrom) > 0 {
+		return fmt.Errorf("build cache_from is not supported by the %s backend", backendKaniko)
+	}
+
+	// verify only a single cache is exported
+	if len(b.CacheTo) > 1 {
+		return fmt.Errorf("multiple build cache_to are not supported by the %s backend", backendKaniko)
+	}
+
+	// verify the cache is exported to a registry
+	for _, cache := range b.CacheTo {
+		if specFields(cacheSpec(cache))["type"] != cacheRegistry {
+			return fmt.Errorf("build cache_to %s is not supported by the %s backend", cache, backendKaniko)
+		}
+	}
+
+	// verify the output is a tarball
+	if len(b.Output) > 0 && len(tarPath(b.Output)) == 0 {
+		return fmt.Errorf("build output %s is not supported by the %s backend", b.Output, backendKaniko)
+	}
+
+	// verify only a single platform is provided
+	if len(b.Platforms) > 1 {
+		return fmt.Errorf("multiple build platforms are not supported by the %s backend", backendKaniko)
+	}
+
+	// verify secrets are not provided
+	if len(b.Secrets) > 0 {
+		return fmt.Errorf("build secrets are not supported by the %s backend", backendKaniko)
+	}
+
+	// verify SSH is not provided
+	if len(b.SSH) > 0 {
+		return fmt.Errorf("build ssh is not supported by the %s backend", backendKaniko)
+	}
+
+	return nil
+}
+
+// Version formats the kaniko version command.
+func (*kanikoBackend) Version(i *Img) *exec.Cmd {
+	return exec.Command(_kaniko, "version")
+}
+
+// tarPath returns the destination from a BuildKit output specification
+// in the 'type=tar,dest=path' format or an empty string for other outputs.
+func tarPath(output string) string {
+	fields := specFields(output)
+
+	// check if the output is a tarball
+	if fields["type"] != "tar" {
+		return ""
+	}
+
+	return fields["dest"]
+}
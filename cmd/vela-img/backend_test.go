@@ -0,0 +1,354 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestImg_newBackend(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: backendImg},
+		{name: backendImg, want: backendImg},
+		{name: backendBuildctl, want: backendBuildctl},
+		{name: backendKaniko, want: backendKaniko},
+		{name: "docker", wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got, err := newBackend(test.name)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("newBackend for %s should have returned err", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("newBackend for %s returned err: %v", test.name, err)
+
+			continue
+		}
+
+		if got.Name() != test.want {
+			t.Errorf("newBackend for %s is %s, want %s", test.name, got.Name(), test.want)
+		}
+	}
+}
+
+func TestImg_buildctlBackend_Command(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build *Build
+		want  []string
+	}{
+		{
+			build: &Build{
+				BuildArgs: []string{"FOO=bar"},
+				CacheFrom: []string{"index.docker.io/target/vela-img:cache"},
+				Directory: ".",
+				File:      "docker/Dockerfile.prod",
+				Labels:    []string{"foo=bar"},
+				NoCache:   true,
+				NoConsole: true,
+				Platforms: []string{"linux/amd64", "linux/arm64"},
+				Tags:      []string{"index.docker.io/target/vela-img:latest", "index.docker.io/target/vela-img:v1"},
+				Target:    "prod",
+				publish:   true,
+			},
+			want: []string{
+				"--frontend=dockerfile.v0",
+				"--local=context=.",
+				"--opt=filename=Dockerfile.prod",
+				"--local=dockerfile=docker",
+				"--opt=build-arg:FOO=bar",
+				"--opt=label:foo=bar",
+				"--opt=platform=linux/amd64,linux/arm64",
+				"--opt=target=prod",
+				"--import-cache=type=registry,ref=index.docker.io/target/vela-img:cache",
+				"--no-cache",
+				"--progress=plain",
+				"--output=type=image,\"name=index.docker.io/target/vela-img:latest,index.docker.io/target/vela-img:v1\",push=true",
+			},
+		},
+		{
+			build: &Build{
+				AutoCache: true,
+				CacheTo:   []string{"type=local,dest=.cache"},
+				Directory: ".",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+			},
+			want: []string{
+				"--frontend=dockerfile.v0",
+				"--local=context=.",
+				"--local=dockerfile=.",
+				"--import-cache=type=registry,ref=index.docker.io/target/vela-img:buildcache",
+				"--export-cache=type=local,dest=.cache",
+				"--export-cache=type=registry,ref=index.docker.io/target/vela-img:buildcache,mode=max",
+				"--output=type=image,\"name=index.docker.io/target/vela-img:latest\",push=false",
+			},
+		},
+		{
+			build: &Build{
+				Directory: ".",
+				Output:    "type=tar,dest=build.tar",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+			},
+			want: []string{
+				"--frontend=dockerfile.v0",
+				"--local=context=.",
+				"--local=dockerfile=.",
+				"--output=type=tar,dest=build.tar",
+			},
+		},
+		{
+			build: &Build{
+				Directory: ".",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+				archive:   "/tmp/image.tar",
+				publish:   true,
+			},
+			want: []string{
+				"--frontend=dockerfile.v0",
+				"--local=context=.",
+				"--local=dockerfile=.",
+				"--output=type=image,\"name=index.docker.io/target/vela-img:latest\",push=true",
+				"--output=type=docker,dest=/tmp/image.tar",
+			},
+		},
+		{
+			build: &Build{
+				Directory: ".",
+				Tags:      []string{"localhost:5000/target/vela-img:latest"},
+				insecure:  true,
+				publish:   true,
+			},
+			want: []string{
+				"--frontend=dockerfile.v0",
+				"--local=context=.",
+				"--local=dockerfile=.",
+				"--output=type=image,\"name=localhost:5000/target/vela-img:latest\",push=true,registry.insecure=true",
+			},
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := new(buildctlBackend).Command(test.build)
+
+		want := append([]string{_buildctlDaemonless, buildAction}, test.want...)
+
+		if !reflect.DeepEqual(got.Args, want) {
+			t.Errorf("Command args are %v, want %v", got.Args, want)
+		}
+	}
+}
+
+func TestImg_kanikoBackend_Command(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build *Build
+		want  []string
+	}{
+		{
+			build: &Build{
+				BuildArgs: []string{"FOO=bar"},
+				Directory: ".",
+				File:      "Dockerfile.prod",
+				Labels:    []string{"foo=bar"},
+				Platforms: []string{"linux/arm64"},
+				Tags:      []string{"index.docker.io/target/vela-img:latest", "index.docker.io/target/vela-img:v1"},
+				Target:    "prod",
+				publish:   true,
+			},
+			want: []string{
+				"--context=.",
+				"--dockerfile=Dockerfile.prod",
+				"--build-arg=FOO=bar",
+				"--label=foo=bar",
+				"--custom-platform=linux/arm64",
+				"--target=prod",
+				"--destination=index.docker.io/target/vela-img:latest",
+				"--destination=index.docker.io/target/vela-img:v1",
+			},
+		},
+		{
+			build: &Build{
+				CacheTo:   []string{"index.docker.io/target/vela-img/cache"},
+				Directory: ".",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+				publish:   true,
+			},
+			want: []string{
+				"--context=.",
+				"--cache=true",
+				"--cache-repo=index.docker.io/target/vela-img/cache",
+				"--destination=index.docker.io/target/vela-img:latest",
+			},
+		},
+		{
+			build: &Build{
+				Directory: ".",
+				Output:    "type=tar,dest=build.tar",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+			},
+			want: []string{
+				"--context=.",
+				"--tar-path=build.tar",
+				"--destination=index.docker.io/target/vela-img:latest",
+				"--no-push",
+			},
+		},
+		{
+			build: &Build{
+				Directory: ".",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+				archive:   "/tmp/image.tar",
+				publish:   true,
+			},
+			want: []string{
+				"--context=.",
+				"--tar-path=/tmp/image.tar",
+				"--destination=index.docker.io/target/vela-img:latest",
+			},
+		},
+		{
+			build: &Build{
+				Directory: ".",
+				Tags:      []string{"localhost:5000/target/vela-img:latest"},
+				insecure:  true,
+				publish:   true,
+			},
+			want: []string{
+				"--context=.",
+				"--destination=localhost:5000/target/vela-img:latest",
+				"--insecure",
+			},
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := new(kanikoBackend).Command(test.build)
+
+		want := append([]string{_kaniko}, test.want...)
+
+		if !reflect.DeepEqual(got.Args, want) {
+			t.Errorf("Command args are %v, want %v", got.Args, want)
+		}
+	}
+}
+
+func TestImg_imgBackend_Save(t *testing.T) {
+	// setup types
+	r := new(fakeRunner)
+
+	b := &Build{
+		Img:     &Img{Runner: r},
+		Tags:    []string{"index.docker.io/target/vela-img:latest", "index.docker.io/target/vela-img:v1"},
+		archive: "/tmp/image.tar",
+	}
+
+	err := new(imgBackend).Save(context.Background(), b)
+	if err != nil {
+		t.Errorf("Save returned err: %v", err)
+	}
+
+	want := [][]string{{_img, saveAction, "--output=/tmp/image.tar", "index.docker.io/target/vela-img:latest"}}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Save calls are %v, want %v", r.calls, want)
+	}
+}
+
+func TestImg_imgBackend_Validate(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build   *Build
+		wantErr bool
+	}{
+		{build: &Build{CacheFrom: []string{"index.docker.io/target/vela-img:cache"}}, wantErr: false},
+		{build: &Build{CacheFrom: []string{"type=local,src=.cache"}}, wantErr: true},
+		{build: &Build{CacheTo: []string{"type=local,dest=.cache"}}, wantErr: true},
+		{build: &Build{AutoCache: true}, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := new(imgBackend).Validate(test.build)
+
+		if test.wantErr && err == nil {
+			t.Errorf("Validate for %+v should have returned err", test.build)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("Validate for %+v returned err: %v", test.build, err)
+		}
+	}
+}
+
+func TestImg_kanikoBackend_Validate(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build   *Build
+		wantErr bool
+	}{
+		{build: &Build{Platforms: []string{"linux/amd64"}}, wantErr: false},
+		{build: &Build{Output: "type=tar,dest=build.tar"}, wantErr: false},
+		{build: &Build{CacheTo: []string{"index.docker.io/target/vela-img/cache"}}, wantErr: false},
+		{build: &Build{CacheFrom: []string{"index.docker.io/target/vela-img:cache"}}, wantErr: true},
+		{build: &Build{CacheTo: []string{"type=local,dest=.cache"}}, wantErr: true},
+		{build: &Build{CacheTo: []string{"index.docker.io/target/a", "index.docker.io/target/b"}}, wantErr: true},
+		{build: &Build{Output: "type=local,dest=out"}, wantErr: true},
+		{build: &Build{Platforms: []string{"linux/amd64", "linux/arm64"}}, wantErr: true},
+		{build: &Build{Secrets: []string{"token=GITHUB_TOKEN"}}, wantErr: true},
+		{build: &Build{SSH: "key"}, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := new(kanikoBackend).Validate(test.build)
+
+		if test.wantErr && err == nil {
+			t.Errorf("Validate for %+v should have returned err", test.build)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("Validate for %+v returned err: %v", test.build, err)
+		}
+	}
+}
+
+func TestImg_tarPath(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{output: "type=tar,dest=build.tar", want: "build.tar"},
+		{output: "dest=build.tar, type=tar", want: "build.tar"},
+		{output: "type=local,dest=out", want: ""},
+		{output: "", want: ""},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := tarPath(test.output)
+
+		if got != test.want {
+			t.Errorf("tarPath for %s is %s, want %s", test.output, got, test.want)
+		}
+	}
+}
@@ -5,11 +5,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
 	"github.com/urfave/cli/v2"
 )
 
@@ -17,44 +20,148 @@ const buildAction = "build"
 
 // Build represents the plugin configuration for build information.
 type Build struct {
+	// AutoCache should import and export the cache with a reference derived from the first tag
+	AutoCache bool `json:"auto_cache"`
+	// AutoLabels should create OCI labels from the Vela build information
+	AutoLabels bool `json:"auto_labels"`
+	// AutoTag should create tags from the Vela build information
+	AutoTag bool `json:"auto_tag"`
+	// Backend should be the tool building the image (img|buildctl|kaniko)
+	Backend string `json:"backend"`
 	// BuildArg should set build time variables
-	BuildArgs []string
+	BuildArgs []string `json:"build_args"`
+	// BuildArgsFile should be a dotenv or JSON file with build time variables
+	BuildArgsFile string `json:"build_args_file"`
 	// CacheFrom should be images to consider as cache sources
-	CacheFrom []string
+	CacheFrom []string `json:"cache_from"`
+	// CacheTo should be registry references or directories to export the cache to
+	CacheTo []string `json:"cache_to"`
 	// directory should be a path to the context you want img to run
-	Directory string
+	Directory string `json:"directory"`
 	// File should be name and path to the Dockerfile
-	File string
+	File string `json:"file"`
 	// Labels should be set metadata for an image
-	Labels []string
+	Labels []string `json:"labels"`
+	// Img should be the img binary running the build
+	Img *Img `json:"-"`
+	// Metadata should be the Vela build information for the image
+	Metadata *Metadata `json:"-"`
 	// NoCache should be do not use cache when building the image
-	NoCache bool
+	NoCache bool `json:"no_cache"`
 	// NoConole should be non-console progress UI
-	NoConsole bool
+	NoConsole bool `json:"no_console"`
 	// Output BuildKit output specification (e.g. type=tar,dest=build.tar)
-	Output string
+	Output string `json:"output"`
 	// Platform should be platforms for which the image should be built
-	Platforms []string
+	Platforms []string `json:"platforms"`
+	// Provenance should be where the provenance for the image is stored (file|attach)
+	Provenance string `json:"provenance"`
+	// ProvenanceFile should be the path to write the provenance to
+	ProvenanceFile string `json:"provenance_file"`
+	// Repo should be the name of the image used for automatic tags
+	Repo string `json:"repo"`
+	// SBOM should be the format of the software bill of materials created for the image (spdx|cyclonedx)
+	SBOM string `json:"sbom"`
+	// SBOMFile should be the path to write the software bill of materials to
+	SBOMFile string `json:"sbom_file"`
+	// Secrets should be secrets exposed to the build in the 'id=source' format
+	Secrets []string `json:"secrets"`
+	// SSH should be the private key exposed to the build through an SSH agent
+	SSH string `json:"ssh"`
 	// Tag should be name and optionally a tag in the 'name:tag' format
-	Tags []string
+	Tags []string `json:"tags"`
 	// Target should be the target build stage to build
-	Target string
+	Target string `json:"target"`
+
+	// archive the image is saved to for the software bill of materials
+	archive string
+	// digest captured for the image
+	digest string
+	// file the backend writes the digest to
+	digestFile string
+	// build time variables loaded from the file
+	fileArgs []string
+	// publish the image as part of the build for backends that support it
+	publish bool
+	// indicates the image was published to the registry
+	pushed bool
+	// indicates the image is published to a registry over http
+	insecure bool
+	// secrets mounted for the build
+	secrets []*secret
+	// signatures uploaded for the image
+	signatures []string
+	// agent serving the private key for the build
+	agent *sshAgent
+	// socket for the SSH agent provided to the build
+	socket string
+	// indicates placeholders are used for the resources of the build
+	placeholders bool
+	// provenance written or attached for the image
+	attestations []string
+	// time the build started
+	started time.Time
+	// time the build finished
+	finished time.Time
 }
 
 // buildFlags represents for config settings on the cli.
 var buildFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:     "build.auto_cache",
+		Usage:    "should import and export the cache with a reference derived from the first tag",
+		EnvVars:  []string{"PARAMETER_AUTO_CACHE", "BUILD_AUTO_CACHE"},
+		FilePath: string("/vela/parameters/img/build/auto_cache,/vela/secrets/img/build/auto_cache"),
+	},
+	&cli.BoolFlag{
+		Name:     "build.auto_labels",
+		Usage:    "should create OCI labels from the Vela build information",
+		EnvVars:  []string{"PARAMETER_AUTO_LABELS", "BUILD_AUTO_LABELS"},
+		FilePath: string("/vela/parameters/img/build/auto_labels,/vela/secrets/img/build/auto_labels"),
+	},
+	&cli.BoolFlag{
+		Name:     "build.auto_tag",
+		Usage:    "should create tags from the Vela build information",
+		EnvVars:  []string{"PARAMETER_AUTO_TAG", "BUILD_AUTO_TAG"},
+		FilePath: string("/vela/parameters/img/build/auto_tag,/vela/secrets/img/build/auto_tag"),
+	},
+	&cli.StringFlag{
+		Name:     "build.backend",
+		Usage:    "should be the tool building the image (img|buildctl|kaniko)",
+		EnvVars:  []string{"PARAMETER_BACKEND", "BUILD_BACKEND"},
+		FilePath: string("/vela/parameters/img/build/backend,/vela/secrets/img/build/backend"),
+		Value:    backendImg,
+	},
 	&cli.StringSliceFlag{
 		Name:     "build.build-args",
-		Usage:    "should be images to consider as cache sources",
+		Usage:    "should set build time variables",
 		EnvVars:  []string{"PARAMETER_BUILD_ARGS", "BUILD_BUILD_ARGS"},
 		FilePath: string("/vela/parameters/img/build/build_args,/vela/secrets/img/build/build_args"),
 	},
+	&cli.StringFlag{
+		Name:     "build.build_args_file",
+		Usage:    "should be a dotenv or JSON file with build time variables",
+		EnvVars:  []string{"PARAMETER_BUILD_ARGS_FILE", "BUILD_BUILD_ARGS_FILE"},
+		FilePath: string("/vela/parameters/img/build/build_args_file,/vela/secrets/img/build/build_args_file"),
+	},
+	&cli.StringFlag{
+		Name:     "build.config",
+		Usage:    "should be a JSON or YAML object with the build configuration",
+		EnvVars:  []string{"PARAMETER_BUILD", "BUILD_CONFIG"},
+		FilePath: string("/vela/parameters/img/build/config,/vela/secrets/img/build/config"),
+	},
 	&cli.StringSliceFlag{
 		Name:     "build.cache-from",
-		Usage:    "should set build time variables",
+		Usage:    "should be images to consider as cache sources",
 		EnvVars:  []string{"PARAMETER_CACHE_FROM", "BUILD_CACHE_FROM"},
 		FilePath: string("/vela/parameters/img/build/cache_from,/vela/secrets/img/build/cache_from"),
 	},
+	&cli.StringSliceFlag{
+		Name:     "build.cache_to",
+		Usage:    "should be registry references or directories to export the cache to (e.g. type=local,dest=.cache)",
+		EnvVars:  []string{"PARAMETER_CACHE_TO", "BUILD_CACHE_TO"},
+		FilePath: string("/vela/parameters/img/build/cache_to,/vela/secrets/img/build/cache_to"),
+	},
 	&cli.StringFlag{
 		Name:     "build.directory",
 		Usage:    "should be a path to the context you want img to run",
@@ -74,6 +181,18 @@ var buildFlags = []cli.Flag{
 		EnvVars:  []string{"PARAMETER_LABELS", "BUILD_LABELS"},
 		FilePath: string("/vela/parameters/img/build/labels,/vela/secrets/img/build/labels"),
 	},
+	&cli.StringFlag{
+		Name:     "build.matrix",
+		Usage:    "should be a JSON or YAML list of build configurations for building several images",
+		EnvVars:  []string{"PARAMETER_BUILDS", "BUILD_MATRIX"},
+		FilePath: string("/vela/parameters/img/build/matrix,/vela/secrets/img/build/matrix"),
+	},
+	&cli.StringFlag{
+		Name:     "build.metadata_file",
+		Usage:    "should be the path to write a JSON file with the digest and tags for each image",
+		EnvVars:  []string{"PARAMETER_METADATA_FILE", "BUILD_METADATA_FILE"},
+		FilePath: string("/vela/parameters/img/build/metadata_file,/vela/secrets/img/build/metadata_file"),
+	},
 	&cli.BoolFlag{
 		Name:     "build.no-cache",
 		Usage:    "should be do not use cache when building the image",
@@ -92,12 +211,73 @@ var buildFlags = []cli.Flag{
 		EnvVars:  []string{"PARAMETER_OUTPUT", "BUILD_OUTPUT"},
 		FilePath: string("/vela/parameters/img/build/output,/vela/secrets/img/build/output"),
 	},
+	&cli.IntFlag{
+		Name:     "build.parallel",
+		Usage:    "should be the maximum number of images built at the same time - not supported by the img backend",
+		EnvVars:  []string{"PARAMETER_PARALLEL", "BUILD_PARALLEL"},
+		FilePath: string("/vela/parameters/img/build/parallel,/vela/secrets/img/build/parallel"),
+		Value:    1,
+	},
 	&cli.StringSliceFlag{
 		Name:     "build.platforms",
 		Usage:    "should be platforms for which the image should be built",
 		EnvVars:  []string{"PARAMETER_PLATFORMS", "BUILD_PLATFORMS"},
 		FilePath: string("/vela/parameters/img/build/platform,/vela/secrets/img/build/platform"),
 	},
+	&cli.BoolFlag{
+		Name:     "build.prune",
+		Usage:    "should remove the unused data from the img state after the builds",
+		EnvVars:  []string{"PARAMETER_PRUNE", "BUILD_PRUNE"},
+		FilePath: string("/vela/parameters/img/build/prune,/vela/secrets/img/build/prune"),
+	},
+	&cli.StringFlag{
+		Name:     "build.provenance",
+		Usage:    "should be where the provenance for the image is stored - options: (file|attach)",
+		EnvVars:  []string{"PARAMETER_PROVENANCE", "BUILD_PROVENANCE"},
+		FilePath: string("/vela/parameters/img/build/provenance,/vela/secrets/img/build/provenance"),
+	},
+	&cli.StringFlag{
+		Name:     "build.provenance_file",
+		Usage:    "should be the path to write the provenance to",
+		EnvVars:  []string{"PARAMETER_PROVENANCE_FILE", "BUILD_PROVENANCE_FILE"},
+		FilePath: string("/vela/parameters/img/build/provenance_file,/vela/secrets/img/build/provenance_file"),
+	},
+	&cli.StringFlag{
+		Name:     "build.repo",
+		Usage:    "should be the name of the image used for automatic tags",
+		EnvVars:  []string{"PARAMETER_REPO", "BUILD_REPO"},
+		FilePath: string("/vela/parameters/img/build/repo,/vela/secrets/img/build/repo"),
+	},
+	&cli.StringFlag{
+		Name:     "build.sbom",
+		Usage:    "should be the format of the software bill of materials created for the image (spdx|cyclonedx)",
+		EnvVars:  []string{"PARAMETER_SBOM", "BUILD_SBOM"},
+		FilePath: string("/vela/parameters/img/build/sbom,/vela/secrets/img/build/sbom"),
+	},
+	&cli.StringFlag{
+		Name:     "build.sbom_file",
+		Usage:    "should be the path to write the software bill of materials to",
+		EnvVars:  []string{"PARAMETER_SBOM_FILE", "BUILD_SBOM_FILE"},
+		FilePath: string("/vela/parameters/img/build/sbom_file,/vela/secrets/img/build/sbom_file"),
+	},
+	&cli.StringSliceFlag{
+		Name:     "build.secrets",
+		Usage:    "should be secrets exposed to the build in the 'id=source' format",
+		EnvVars:  []string{"PARAMETER_SECRETS", "BUILD_SECRETS"},
+		FilePath: string("/vela/parameters/img/build/secrets,/vela/secrets/img/build/secrets"),
+	},
+	&cli.StringFlag{
+		Name:     "build.ssh",
+		Usage:    "should be the private key exposed to the build through an SSH agent",
+		EnvVars:  []string{"PARAMETER_SSH", "BUILD_SSH", "SSH_KEY"},
+		FilePath: string("/vela/parameters/img/build/ssh,/vela/secrets/img/build/ssh,/vela/secrets/img/ssh_key"),
+	},
+	&cli.StringFlag{
+		Name:     "build.state",
+		Usage:    "should be the directory img stores the images and cache in (e.g. a workspace or volume path)",
+		EnvVars:  []string{"PARAMETER_STATE", "BUILD_STATE"},
+		FilePath: string("/vela/parameters/img/build/state,/vela/secrets/img/build/state"),
+	},
 	&cli.StringSliceFlag{
 		Name:     "build.tags",
 		Usage:    "should be name and optionally a tag in the 'name:tag' format",
@@ -110,120 +290,384 @@ var buildFlags = []cli.Flag{
 		EnvVars:  []string{"PARAMETER_TARGET", "BUILD_TARGET"},
 		FilePath: string("/vela/parameters/img/build/target,/vela/secrets/img/build/target"),
 	},
+	&cli.DurationFlag{
+		Name:     "build.timeout",
+		Usage:    "should be the maximum duration for building and publishing the images",
+		EnvVars:  []string{"PARAMETER_TIMEOUT", "BUILD_TIMEOUT"},
+		FilePath: string("/vela/parameters/img/build/timeout,/vela/secrets/img/build/timeout"),
+	},
 }
 
 // Command formats and outputs the Build command from
 // the provided configuration to build a Docker image.
 func (b *Build) Command() *exec.Cmd {
-	logrus.Trace("creating img build command from plugin configuration")
+	return b.backend().Command(b)
+}
 
-	// variable to store flags for command
-	var flags []string
+// backend returns the backend building the image. The
+// img backend is returned for an invalid backend which
+// is rejected when validating the Build.
+func (b *Build) backend() backend {
+	be, err := newBackend(b.Backend)
+	if err != nil {
+		return new(imgBackend)
+	}
 
-	// check if BuildArgs is provided
-	if len(b.BuildArgs) > 0 {
-		var args string
-		for _, arg := range b.BuildArgs {
-			args += fmt.Sprintf(" %s", arg)
+	return be
+}
+
+// AllBuildArgs returns the build args loaded from the file along with
+// the provided build args. Provided build args take precedence over
+// build args from the file with the same key and a bare 'KEY' uses
+// the value from the environment like 'docker build --build-arg KEY'.
+func (b *Build) AllBuildArgs() []string {
+	// variable to store build args for the image
+	var args []string
+
+	// variable to store the index for each key
+	index := make(map[string]int)
+
+	for _, arg := range append(append([]string{}, b.fileArgs...), b.BuildArgs...) {
+		arg, ok := resolveBuildArg(arg)
+		if !ok {
+			logrus.Warnf("no value found in environment for build arg %s - skipping", arg)
+
+			continue
 		}
-		// add flag for BuildArgs from provided build command
-		flags = append(flags, fmt.Sprintf("--build-arg \"%s\"", strings.TrimPrefix(args, " ")))
-	}
 
-	// check if CacheFrom is provided
-	if len(b.CacheFrom) > 0 {
-		var caches string
-		for _, cache := range b.CacheFrom {
-			caches += fmt.Sprintf(" %s", cache)
+		key := keyOf(arg)
+
+		// check if the key was already provided
+		if i, ok := index[key]; ok {
+			args[i] = arg
+
+			continue
 		}
-		// add flag for CacheFrom from provided build command
-		flags = append(flags, fmt.Sprintf("--cache-from \"%s\"", strings.TrimPrefix(caches, " ")))
-	}
 
-	// check if File is provided
-	if len(b.File) > 0 {
-		// add flag for File from provided build command
-		flags = append(flags, fmt.Sprintf("-f=%s", b.File))
+		index[key] = len(args)
+
+		args = append(args, arg)
 	}
 
-	// check if Labels is provided
-	if len(b.Labels) > 0 {
-		var labels string
-		for _, label := range b.Labels {
-			labels += fmt.Sprintf(" %s", label)
+	return args
+}
+
+// secretBuildArgs returns the values for the build args
+// that are derived from secrets mounted for the plugin.
+func (b *Build) secretBuildArgs() []string {
+	// variable to store secret values
+	secrets := secretValues()
+
+	// check if the file is within the secrets directory
+	if len(b.BuildArgsFile) > 0 && isSecretPath(b.BuildArgsFile) {
+		for _, arg := range b.fileArgs {
+			secrets = append(secrets, strings.SplitN(arg, "=", 2)[1])
 		}
-		// add flag for Labels from provided build command
-		flags = append(flags, fmt.Sprintf("--label \"%s\"", strings.TrimPrefix(labels, " ")))
 	}
 
-	// check if NoCache is provided
-	if b.NoCache {
-		// add flag for NoCache from provided build command
-		flags = append(flags, "--no-cache")
+	// variable to store values to mask
+	var masks []string
+
+	for _, arg := range b.AllBuildArgs() {
+		parts := strings.SplitN(arg, "=", 2)
+
+		if len(parts[1]) < minSecretLength || !contains(secrets, parts[1]) {
+			continue
+		}
+
+		logrus.Warnf("build arg %s is derived from a secret and may be exposed in the image history", parts[0])
+
+		masks = append(masks, parts[1])
 	}
 
-	// check if NoConsole is provided
-	if b.NoConsole {
-		// add flag for NoConsole from provided build command
-		flags = append(flags, "--no-console")
+	return masks
+}
+
+// AllLabels returns the automatic labels created from the Vela build
+// information along with the provided labels. Provided labels take
+// precedence over automatic labels with the same key.
+func (b *Build) AllLabels() []string {
+	// check if automatic labels should be created
+	if !b.AutoLabels || b.Metadata == nil {
+		return b.Labels
 	}
 
-	// check if Output is provided
-	if len(b.Output) > 0 {
-		// add flag for Output from provided build command
-		flags = append(flags, fmt.Sprintf("--output %s", b.Output))
+	// variable to store keys for the provided labels
+	keys := make(map[string]bool)
+
+	for _, label := range b.Labels {
+		keys[keyOf(label)] = true
 	}
 
-	// check if Platforms is provided
-	if len(b.Platforms) > 0 {
-		var platforms string
-		for _, platform := range b.Platforms {
-			platforms += fmt.Sprintf(" %s", platform)
+	// variable to store labels for the image
+	var labels []string
+
+	for _, label := range b.Metadata.Labels() {
+		if !keys[keyOf(label)] {
+			labels = append(labels, label)
 		}
-		// add flag for Labels from provided build command
-		flags = append(flags, fmt.Sprintf("--platform \"%s\"", strings.TrimPrefix(platforms, " ")))
 	}
 
-	// check if Tags is provided
-	if len(b.Tags) > 0 {
-		var tags string
-		for _, tag := range b.Tags {
-			tags += fmt.Sprintf(" %s", tag)
-		}
-		// add flag for Labels from provided build command
-		flags = append(flags, fmt.Sprintf("-t=%s", strings.TrimPrefix(tags, " ")))
+	return append(labels, b.Labels...)
+}
+
+// Name returns a description of the Build used in the output.
+func (b *Build) Name() string {
+	// check if tags are provided
+	if tags := b.AllTags(); len(tags) > 0 {
+		return tags[0]
 	}
 
-	// check if Target is provided
-	if len(b.Target) > 0 {
-		// add flag for Target from provided build command
-		flags = append(flags, fmt.Sprintf("--target %s", b.Target))
+	// check if File is provided
+	if len(b.File) > 0 {
+		return b.File
+	}
+
+	return b.Directory
+}
+
+// AllTags returns the provided tags along with the
+// automatic tags created from the Vela build information.
+func (b *Build) AllTags() []string {
+	// check if automatic tags should be created
+	if !b.AutoTag || b.Metadata == nil {
+		return b.Tags
 	}
 
-	// add the required directory param
-	flags = append(flags, b.Directory)
+	// variable to store tags for the image
+	tags := append([]string{}, b.Tags...)
 
-	// nolint:gosec // this functionality is not exploitable the way
-	// the plugin accepts configuration
-	return exec.Command(_img, append([]string{buildAction}, flags...)...)
+	for _, tag := range b.Metadata.Tags(b.Repo) {
+		if !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
 }
 
 // Exec formats and runs the commands for building a Docker image.
-func (b *Build) Exec() error {
+func (b *Build) Exec(ctx context.Context) error {
 	logrus.Trace("running build with provided configuration")
 
+	// remove the resources prepared for the build
+	defer b.cleanup()
+
+	// prepare the resources for the build
+	masks, err := b.setup()
+	if err != nil {
+		return err
+	}
+
 	// create the build command for the file
 	cmd := b.Command()
 
+	b.started = time.Now()
+
 	// run the build command for the file
-	err := execCmd(cmd)
+	_, err = b.Img.Run(ctx, cmd, masks...)
 	if err != nil {
 		return err
 	}
 
+	b.finished = time.Now()
+
+	// capture the digest for the image
+	b.digest, err = b.backend().Digest(ctx, b)
+	if err != nil {
+		logrus.Warnf("unable to capture digest for image: %v", err)
+	}
+
+	// check if SBOM is provided
+	if len(b.SBOM) > 0 {
+		return b.writeSBOM(ctx)
+	}
+
 	return nil
 }
 
+// setup prepares the secrets, build args and SSH agent for the
+// build and returns the values that should be masked in the output.
+func (b *Build) setup() ([]string, error) {
+	// mount the secrets for the build
+	masks, err := b.mountSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	// check if BuildArgsFile is provided
+	if len(b.BuildArgsFile) > 0 {
+		// load the build args from the file
+		b.fileArgs, err = readBuildArgsFile(b.BuildArgsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// mask the build args derived from secrets
+	masks = append(masks, b.secretBuildArgs()...)
+
+	// check if SSH is provided
+	if len(b.SSH) > 0 {
+		// start the SSH agent for the build
+		b.agent, err = startAgent(b.SSH)
+		if err != nil {
+			return nil, err
+		}
+
+		b.socket = b.agent.Socket()
+	}
+
+	// create the file the backend writes the digest to
+	b.digestFile, err = tempFile("vela-img-digest-")
+	if err != nil {
+		return nil, err
+	}
+
+	// check if the image must be saved for the software bill of materials
+	if len(b.SBOM) > 0 && len(b.Output) == 0 {
+		// create the archive the image is saved to
+		b.archive, err = tempFile("vela-img-sbom-")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return masks, nil
+}
+
+// preview prepares the build for printing the commands with placeholders
+// for the secrets, SSH agent and temporary files so no secret values are
+// written to disk and returns the values that should be masked in the output.
+func (b *Build) preview() ([]string, error) {
+	b.placeholders = true
+
+	for _, input := range b.Secrets {
+		s, err := parseSecret(input)
+		if err != nil {
+			return nil, err
+		}
+
+		// check if the secret is sourced from an environment variable
+		s.src = s.Source
+		if !s.isFile() {
+			s.src = fmt.Sprintf("<env:%s>", s.Source)
+		}
+
+		b.secrets = append(b.secrets, s)
+	}
+
+	// check if BuildArgsFile is provided
+	if len(b.BuildArgsFile) > 0 {
+		var err error
+
+		// load the build args from the file
+		b.fileArgs, err = readBuildArgsFile(b.BuildArgsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// check if SSH is provided
+	if len(b.SSH) > 0 {
+		b.socket = "<ssh-agent>"
+	}
+
+	b.digestFile = "<digest-file>"
+
+	// check if the image must be saved for the software bill of materials
+	if len(b.SBOM) > 0 && len(b.Output) == 0 {
+		b.archive = "<sbom-archive>"
+	}
+
+	// mask the build args derived from secrets
+	return b.secretBuildArgs(), nil
+}
+
+// cleanup removes the secrets, digest file, archive and stops the SSH agent for the build.
+func (b *Build) cleanup() {
+	// check if placeholders were used for the resources
+	if b.placeholders {
+		b.secrets = nil
+		b.socket = ""
+		b.digestFile = ""
+		b.archive = ""
+		b.placeholders = false
+
+		return
+	}
+
+	b.unmountSecrets()
+
+	// check if a digest file was created
+	if len(b.digestFile) > 0 {
+		_ = appFS.Remove(b.digestFile)
+
+		b.digestFile = ""
+	}
+
+	// check if an archive was created
+	if len(b.archive) > 0 {
+		_ = appFS.Remove(b.archive)
+
+		b.archive = ""
+	}
+
+	// check if an SSH agent is running
+	if b.agent != nil {
+		b.stopAgent()
+	}
+
+	b.socket = ""
+}
+
+// mountSecrets prepares the secrets for the build and
+// returns the values that should be masked in the output.
+func (b *Build) mountSecrets() ([]string, error) {
+	// variable to store values to mask
+	var masks []string
+
+	for _, input := range b.Secrets {
+		s, err := parseSecret(input)
+		if err != nil {
+			return nil, err
+		}
+
+		b.secrets = append(b.secrets, s)
+
+		err = s.Mount()
+		if err != nil {
+			return nil, err
+		}
+
+		masks = append(masks, s.value)
+	}
+
+	return masks, nil
+}
+
+// stopAgent stops the SSH agent running for the build.
+func (b *Build) stopAgent() {
+	err := b.agent.Stop()
+	if err != nil {
+		logrus.Warnf("unable to stop build ssh agent: %v", err)
+	}
+
+	b.agent = nil
+}
+
+// unmountSecrets removes the secrets mounted for the build.
+func (b *Build) unmountSecrets() {
+	for _, s := range b.secrets {
+		err := s.Unmount()
+		if err != nil {
+			logrus.Warnf("unable to remove build secret %s: %v", s.ID, err)
+		}
+	}
+
+	b.secrets = nil
+}
+
 // Validate verifies the Build is properly configured.
 func (b *Build) Validate() error {
 	logrus.Trace("validating build plugin configuration")
@@ -233,10 +677,114 @@ func (b *Build) Validate() error {
 		return fmt.Errorf("no build directory provided")
 	}
 
+	be, err := newBackend(b.Backend)
+	if err != nil {
+		return err
+	}
+
+	// check if automatic tags should be created
+	if b.AutoTag {
+		// verify repo is provided
+		if len(b.Repo) == 0 {
+			return fmt.Errorf("no build repo provided for automatic tags")
+		}
+	}
+
 	// verify tag are provided
-	if len(b.Tags) == 0 {
+	if len(b.AllTags()) == 0 {
 		return fmt.Errorf("no build tag provided")
 	}
 
-	return nil
+	// check if BuildArgsFile is provided
+	if len(b.BuildArgsFile) > 0 {
+		// verify the build args file can be parsed
+		_, err := readBuildArgsFile(b.BuildArgsFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// verify the exported cache is properly formatted
+	for _, cache := range b.CacheTo {
+		err := validateCache(cache)
+		if err != nil {
+			return err
+		}
+	}
+
+	// verify the software bill of materials can be created
+	err = b.validateSBOM()
+	if err != nil {
+		return err
+	}
+
+	// verify the provenance can be created
+	err = b.validateProvenance()
+	if err != nil {
+		return err
+	}
+
+	// verify secrets are properly formatted
+	for _, input := range b.Secrets {
+		_, err := parseSecret(input)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check if SSH is provided
+	if len(b.SSH) > 0 {
+		// verify the private key is valid
+		_, err := parseKey(b.SSH)
+		if err != nil {
+			return err
+		}
+	}
+
+	// verify the backend supports the build configuration
+	return be.Validate(b)
+}
+
+// tempFile creates an empty temporary file and returns the path.
+func tempFile(prefix string) (string, error) {
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	f, err := a.TempFile("", prefix)
+	if err != nil {
+		return "", err
+	}
+
+	return f.Name(), f.Close()
+}
+
+// imageName returns the image with the tag and digest removed.
+func imageName(image string) string {
+	// remove the digest from the image
+	image = strings.SplitN(image, "@", 2)[0]
+
+	// remove the tag from the image while ignoring the registry port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return image
+}
+
+// contains checks if the value exists in the list.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyOf returns the key for the value in the 'key=value' format.
+func keyOf(value string) string {
+	return strings.TrimSpace(strings.SplitN(value, "=", 2)[0])
 }
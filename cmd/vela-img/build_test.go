@@ -5,13 +5,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/spf13/afero"
 )
 
 func TestImg_Build_Command(t *testing.T) {
+	t.Setenv("FOO", "bar")
+
 	// setup types
 	b := &Build{
 		BuildArgs: []string{"FOO"},
@@ -32,16 +40,16 @@ func TestImg_Build_Command(t *testing.T) {
 	want := exec.Command(
 		_img,
 		buildAction,
-		fmt.Sprintf("--build-arg \"%s\"", b.BuildArgs[0]),
-		fmt.Sprintf("--cache-from \"%s\"", b.CacheFrom[0]),
+		"--build-arg=FOO=bar",
+		fmt.Sprintf("--cache-from=%s", b.CacheFrom[0]),
 		fmt.Sprintf("-f=%s", b.File),
-		fmt.Sprintf("--label \"%s\"", b.Labels[0]),
+		fmt.Sprintf("--label=%s", b.Labels[0]),
 		"--no-cache",
 		"--no-console",
-		fmt.Sprintf("--output %s", b.Output),
-		fmt.Sprintf("--platform \"%s\"", b.Platforms[0]),
+		fmt.Sprintf("--output=%s", b.Output),
+		fmt.Sprintf("--platform=%s", b.Platforms[0]),
 		fmt.Sprintf("-t=%s", b.Tags[0]),
-		fmt.Sprintf("--target %s", b.Target),
+		fmt.Sprintf("--target=%s", b.Target),
 		".",
 	)
 
@@ -51,11 +59,135 @@ func TestImg_Build_Command(t *testing.T) {
 	}
 }
 
+func TestImg_Build_Command_Multiple(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		name  string
+		build *Build
+		want  []string
+	}{
+		{
+			name: "build args",
+			build: &Build{
+				BuildArgs: []string{"A=1", "B=2"},
+				Directory: ".",
+			},
+			want: []string{"--build-arg=A=1", "--build-arg=B=2", "."},
+		},
+		{
+			name: "build args with spaces, equals and quotes",
+			build: &Build{
+				BuildArgs: []string{"GREETING=hello world", "QUERY=a=b&c=d", `JSON={"key": "value"}`},
+				Directory: ".",
+			},
+			want: []string{
+				"--build-arg=GREETING=hello world",
+				"--build-arg=QUERY=a=b&c=d",
+				`--build-arg=JSON={"key": "value"}`,
+				".",
+			},
+		},
+		{
+			name: "cache from",
+			build: &Build{
+				CacheFrom: []string{"index.docker.io/target/vela-img:latest", "index.docker.io/target/vela-img:cache"},
+				Directory: ".",
+			},
+			want: []string{
+				"--cache-from=index.docker.io/target/vela-img:latest",
+				"--cache-from=index.docker.io/target/vela-img:cache",
+				".",
+			},
+		},
+		{
+			name: "labels with spaces, equals and quotes",
+			build: &Build{
+				Directory: ".",
+				Labels:    []string{"org.opencontainers.image.title=vela img", `description="quoted"`, "url=https://example.com/?a=b"},
+			},
+			want: []string{
+				"--label=org.opencontainers.image.title=vela img",
+				`--label=description="quoted"`,
+				"--label=url=https://example.com/?a=b",
+				".",
+			},
+		},
+		{
+			name: "platforms",
+			build: &Build{
+				Directory: ".",
+				Platforms: []string{"linux/amd64", "linux/arm64", "linux/arm/v7"},
+			},
+			want: []string{"--platform=linux/amd64,linux/arm64,linux/arm/v7", "."},
+		},
+		{
+			name: "tags",
+			build: &Build{
+				Directory: "context dir",
+				Tags:      []string{"repo:a", "repo:b"},
+			},
+			want: []string{"-t=repo:a", "-t=repo:b", "context dir"},
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.build.Command()
+
+			want := append([]string{_img, buildAction}, test.want...)
+
+			if !reflect.DeepEqual(got.Args, want) {
+				t.Errorf("Command args are %q, want %q", got.Args, want)
+			}
+		})
+	}
+}
+
+func TestImg_Build_Exec(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	r := &fakeRunner{
+		output: []byte(`NAME                                SIZE      CREATED AT      UPDATED AT      DIGEST
+docker.io/target/vela-img:latest    3.2MiB    2 seconds ago   2 seconds ago   sha256:abc123
+`),
+	}
+
+	b := &Build{
+		Directory: ".",
+		Img:       &Img{Runner: r},
+		Tags:      []string{"index.docker.io/target/vela-img:latest"},
+	}
+
+	err := b.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	want := [][]string{b.Command().Args, {_img, listAction}}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Exec calls are %v, want %v", r.calls, want)
+	}
+
+	if b.digest != "sha256:abc123" {
+		t.Errorf("Exec digest is %s, want sha256:abc123", b.digest)
+	}
+}
+
 func TestImg_Build_Exec_Error(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
 	// setup types
-	b := &Build{}
+	b := &Build{
+		Directory: ".",
+		Img:       &Img{Runner: &fakeRunner{err: errors.New("exit status 1")}},
+	}
 
-	err := b.Exec()
+	err := b.Exec(context.Background())
 	if err == nil {
 		t.Errorf("Exec should have returned err")
 	}
@@ -74,6 +206,31 @@ func TestImg_Build_Validate(t *testing.T) {
 	}
 }
 
+func TestImg_Build_Validate_Backend(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build   *Build
+		wantErr bool
+	}{
+		{build: &Build{Backend: backendBuildctl, Directory: ".", Tags: []string{"image_name:tag"}}, wantErr: false},
+		{build: &Build{Backend: "docker", Directory: ".", Tags: []string{"image_name:tag"}}, wantErr: true},
+		{build: &Build{Backend: backendKaniko, Directory: ".", Platforms: []string{"linux/amd64", "linux/arm64"}, Tags: []string{"image_name:tag"}}, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := test.build.Validate()
+
+		if test.wantErr && err == nil {
+			t.Errorf("Validate for %s should have returned err", test.build.Backend)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("Validate for %s returned err: %v", test.build.Backend, err)
+		}
+	}
+}
+
 func TestImg_Config_Validate_NoTags(t *testing.T) {
 	// setup types
 	b := &Build{
@@ -97,3 +254,249 @@ func TestImg_Config_Validate_NoDirectory(t *testing.T) {
 		t.Errorf("Validate should have returned err")
 	}
 }
+
+func TestImg_Build_AllTags(t *testing.T) {
+	// setup types
+	b := &Build{
+		AutoTag:   true,
+		Directory: ".",
+		Metadata: &Metadata{
+			Commit: "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+			Event:  "pull_request",
+		},
+		Repo: "target/vela-img",
+		Tags: []string{"target/vela-img:pr", "target/vela-img:7bd468e"},
+	}
+
+	want := []string{"target/vela-img:pr", "target/vela-img:7bd468e"}
+
+	got := b.AllTags()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AllTags is %v, want %v", got, want)
+	}
+}
+
+func TestImg_Build_Validate_AutoTag(t *testing.T) {
+	// setup types
+	b := &Build{
+		AutoTag:   true,
+		Directory: ".",
+		Metadata: &Metadata{
+			Commit: "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+		},
+		Repo: "target/vela-img",
+	}
+
+	err := b.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Build_Validate_AutoTagNoRepo(t *testing.T) {
+	// setup types
+	b := &Build{
+		AutoTag:   true,
+		Directory: ".",
+		Metadata: &Metadata{
+			Commit: "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+		},
+	}
+
+	err := b.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Build_AllLabels(t *testing.T) {
+	// setup types
+	b := &Build{
+		AutoLabels: true,
+		Labels: []string{
+			"org.opencontainers.image.source=https://example.com/mirror",
+			"team=vela",
+		},
+		Metadata: &Metadata{
+			Commit: "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+			Link:   "https://github.com/go-vela/vela-img",
+		},
+	}
+
+	want := []string{
+		"org.opencontainers.image.revision=7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+		"org.opencontainers.image.url=https://github.com/go-vela/vela-img",
+		"org.opencontainers.image.source=https://example.com/mirror",
+		"team=vela",
+	}
+
+	got := b.AllLabels()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AllLabels is %v, want %v", got, want)
+	}
+}
+
+func TestImg_Build_Exec_Secrets(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	t.Setenv("GITHUB_TOKEN", "superSecretToken")
+
+	// setup types
+	b := &Build{
+		Directory: ".",
+		Img:       &Img{Runner: &fakeRunner{err: errors.New("exit status 1")}},
+		Secrets:   []string{"token=GITHUB_TOKEN"},
+		Tags:      []string{"image_name:tag"},
+	}
+
+	err := b.Exec(context.Background())
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+
+	files, _ := a.ReadDir(os.TempDir())
+	if len(files) > 0 {
+		t.Errorf("Exec should have removed secret files: %v", files)
+	}
+}
+
+func TestImg_Build_preview(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	t.Setenv("GITHUB_TOKEN", "superSecretToken")
+
+	// setup types
+	b := &Build{
+		Directory: ".",
+		Img:       new(Img),
+		SBOM:      sbomSPDX,
+		Secrets:   []string{"token=GITHUB_TOKEN", "npm=/vela/secrets/npmrc"},
+		SSH:       testKey(t),
+		Tags:      []string{"image_name:tag"},
+	}
+
+	masks, err := b.preview()
+	if err != nil {
+		t.Errorf("preview returned err: %v", err)
+	}
+
+	if len(masks) > 0 {
+		t.Errorf("preview masks are %v, want none", masks)
+	}
+
+	got := strings.Join(b.Command().Args, " ")
+
+	for _, want := range []string{
+		"--secret=id=token,src=<env:GITHUB_TOKEN>",
+		"--secret=id=npm,src=/vela/secrets/npmrc",
+		"--ssh=default=<ssh-agent>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Command is %s, want %s", got, want)
+		}
+	}
+
+	// verify nothing was written for the secrets or SSH agent
+	files, _ := a.ReadDir(os.TempDir())
+	if len(files) > 0 {
+		t.Errorf("preview should not have created files: %v", files)
+	}
+
+	if b.agent != nil {
+		t.Errorf("preview should not have started an SSH agent")
+	}
+
+	b.cleanup()
+
+	if len(b.secrets) > 0 || len(b.socket) > 0 || len(b.digestFile) > 0 || len(b.archive) > 0 {
+		t.Errorf("cleanup should have removed the placeholders")
+	}
+}
+
+func TestImg_Build_Validate_InvalidSecret(t *testing.T) {
+	// setup types
+	b := &Build{
+		Directory: ".",
+		Secrets:   []string{"token"},
+		Tags:      []string{"image_name:tag"},
+	}
+
+	err := b.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Build_Validate_InvalidSSH(t *testing.T) {
+	// setup types
+	b := &Build{
+		Directory: ".",
+		SSH:       "not a key",
+		Tags:      []string{"image_name:tag"},
+	}
+
+	err := b.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Build_AllBuildArgs(t *testing.T) {
+	t.Setenv("VELA_IMG_TOKEN", "superSecretToken")
+
+	// setup types
+	b := &Build{
+		BuildArgs: []string{"GOPROXY=https://proxy.example.com", "VELA_IMG_TOKEN", "VELA_IMG_MISSING"},
+		fileArgs:  []string{"GOPROXY=https://proxy.golang.org", "VERSION=1.2.3"},
+	}
+
+	want := []string{
+		"GOPROXY=https://proxy.example.com",
+		"VERSION=1.2.3",
+		"VELA_IMG_TOKEN=superSecretToken",
+	}
+
+	got := b.AllBuildArgs()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AllBuildArgs is %v, want %v", got, want)
+	}
+}
+
+func TestImg_Build_secretBuildArgs(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	_ = a.WriteFile("/vela/secrets/github/token", []byte("superSecretToken\n"), 0600)
+	_ = a.WriteFile("/vela/secrets/github/debug", []byte("true\n"), 0600)
+	_ = a.WriteFile("/vela/secrets/img/build/target", []byte("production\n"), 0600)
+
+	t.Setenv("VELA_IMG_TOKEN", "superSecretToken")
+
+	// setup types
+	b := &Build{
+		BuildArgs:     []string{"VERSION=1.2.3", "DEBUG=true", "ENV=production", "VELA_IMG_TOKEN"},
+		BuildArgsFile: "/vela/secrets/img/build_args.env",
+		fileArgs:      []string{"NPM_TOKEN=otherSecretToken"},
+	}
+
+	want := []string{"otherSecretToken", "superSecretToken"}
+
+	got := b.secretBuildArgs()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("secretBuildArgs is %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+const (
+	// _secrets is the directory containing the secrets mounted for the plugin.
+	_secrets = "/vela/secrets"
+	// _secretParameters is the directory containing the parameters for the plugin
+	// mounted as secrets which are not compared with the build args.
+	_secretParameters = "/vela/secrets/img"
+	// minSecretLength is the length for the shortest secret value compared with
+	// the build args to avoid flagging trivial values such as true or 1.
+	minSecretLength = 6
+)
+
+// readBuildArgsFile parses the dotenv or JSON file into
+// a sorted list of build args in the 'KEY=VALUE' format.
+func readBuildArgsFile(path string) ([]string, error) {
+	logrus.Tracef("reading build args file %s", path)
+
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	data, err := a.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read build args file %s: %w", path, err)
+	}
+
+	// variable to store the values from the file
+	values := make(map[string]string)
+
+	// check if the file contains JSON
+	if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		// variable to store the raw values from the file
+		raw := make(map[string]interface{})
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		err = decoder.Decode(&raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse build args file %s: %w", path, err)
+		}
+
+		for key, value := range raw {
+			values[key], err = scalarValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s in build args file %s: %w", key, path, err)
+			}
+		}
+	} else {
+		values, err = godotenv.Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse build args file %s: %w", path, err)
+		}
+	}
+
+	// variable to store build args from the file
+	args := make([]string, 0, len(values))
+
+	for key, value := range values {
+		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	sort.Strings(args)
+
+	return args, nil
+}
+
+// resolveBuildArg converts a bare 'KEY' to the 'KEY=VALUE' format
+// with the value from the environment. The second return value
+// is false when the value is not found in the environment.
+func resolveBuildArg(arg string) (string, bool) {
+	// check if the value is provided
+	if strings.Contains(arg, "=") {
+		return arg, true
+	}
+
+	value, ok := os.LookupEnv(arg)
+	if !ok {
+		return arg, false
+	}
+
+	return fmt.Sprintf("%s=%s", arg, value), true
+}
+
+// isSecretPath checks if the path is within the secrets directory.
+func isSecretPath(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	return abs == _secrets || strings.HasPrefix(abs, _secrets+string(filepath.Separator))
+}
+
+// secretValues returns the contents of every file mounted within
+// the secrets directory other than the parameters for the plugin.
+func secretValues() []string {
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// variable to store the secret values
+	var values []string
+
+	_ = a.Walk(_secrets, func(path string, info os.FileInfo, err error) error {
+		// skip the parameters for the plugin
+		if err == nil && info.IsDir() && path == _secretParameters {
+			return filepath.SkipDir
+		}
+
+		// skip anything that can not be read
+		if err != nil || info.IsDir() || info.Size() > 1<<20 {
+			return nil
+		}
+
+		data, err := a.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		value := strings.TrimSpace(string(data))
+		if len(value) >= minSecretLength {
+			values = append(values, value)
+		}
+
+		return nil
+	})
+
+	return values
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestImg_readBuildArgsFile(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	_ = a.WriteFile("build_args.env", []byte("# comment\nVERSION=1.2.3\nGREETING=\"hello world\"\n"), 0644)
+	_ = a.WriteFile("build_args.json", []byte(`{"VERSION": "1.2.3", "DEBUG": true, "RETRIES": 3, "BUILD_NUMBER": 12345678, "RATIO": 1.10, "EMPTY": null}`), 0644)
+	_ = a.WriteFile("object.json", []byte(`{"VERSION": {"major": 1}}`), 0644)
+	_ = a.WriteFile("list.json", []byte(`{"VERSION": [1, 2]}`), 0644)
+	_ = a.WriteFile("invalid.json", []byte(`{"VERSION":`), 0644)
+
+	// setup tests
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "build_args.env", want: []string{"GREETING=hello world", "VERSION=1.2.3"}},
+		{path: "build_args.json", want: []string{"BUILD_NUMBER=12345678", "DEBUG=true", "EMPTY=", "RATIO=1.10", "RETRIES=3", "VERSION=1.2.3"}},
+		{path: "object.json", wantErr: true},
+		{path: "list.json", wantErr: true},
+		{path: "invalid.json", wantErr: true},
+		{path: "missing.env", wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got, err := readBuildArgsFile(test.path)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("readBuildArgsFile should have returned err for %s", test.path)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("readBuildArgsFile returned err for %s: %v", test.path, err)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("readBuildArgsFile is %v, want %v", got, test.want)
+		}
+	}
+}
+
+func TestImg_resolveBuildArg(t *testing.T) {
+	t.Setenv("VELA_IMG_VERSION", "1.2.3")
+
+	// setup tests
+	tests := []struct {
+		arg    string
+		want   string
+		wantOk bool
+	}{
+		{arg: "VERSION=1.2.3", want: "VERSION=1.2.3", wantOk: true},
+		{arg: "EMPTY=", want: "EMPTY=", wantOk: true},
+		{arg: "VELA_IMG_VERSION", want: "VELA_IMG_VERSION=1.2.3", wantOk: true},
+		{arg: "VELA_IMG_MISSING", want: "VELA_IMG_MISSING", wantOk: false},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got, ok := resolveBuildArg(test.arg)
+
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("resolveBuildArg is %s %v, want %s %v", got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestImg_isSecretPath(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/vela/secrets/img/build_args.env", want: true},
+		{path: "/vela/secrets/../parameters/build_args.env", want: false},
+		{path: "/vela/secretsfile", want: false},
+		{path: "build_args.env", want: false},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := isSecretPath(test.path)
+
+		if got != test.want {
+			t.Errorf("isSecretPath for %s is %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestImg_secretValues(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	_ = a.WriteFile("/vela/secrets/token", []byte("superSecretToken\n"), 0600)
+	_ = a.WriteFile("/vela/secrets/empty", []byte(""), 0600)
+	_ = a.WriteFile("/vela/secrets/short", []byte("1234"), 0600)
+	_ = a.WriteFile("/vela/secrets/img/build/no_cache", []byte("true"), 0600)
+	_ = a.WriteFile("/vela/secrets/img/registry/password", []byte("superSecretPassword"), 0600)
+
+	want := []string{"superSecretToken"}
+
+	got := secretValues()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("secretValues is %v, want %v", got, want)
+	}
+}
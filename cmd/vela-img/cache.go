@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// cacheRegistry stores the build cache in a registry.
+	cacheRegistry = "registry"
+	// cacheLocal stores the build cache in a directory.
+	cacheLocal = "local"
+	// cacheTag is the tag for the cache derived from the image.
+	cacheTag = "buildcache"
+)
+
+// cacheSpec converts the cache to a BuildKit cache specification.
+// A plain image reference is converted to a registry cache.
+func cacheSpec(cache string) string {
+	// check if the cache is already a specification
+	if isSpec(cache) {
+		return cache
+	}
+
+	return fmt.Sprintf("type=%s,ref=%s", cacheRegistry, cache)
+}
+
+// isSpec checks if the value is a BuildKit specification
+// in the 'key=value,key=value' format instead of an image.
+func isSpec(value string) bool {
+	_, ok := specFields(value)["type"]
+
+	return ok
+}
+
+// specFields parses the BuildKit specification in the
+// 'key=value,key=value' format into the fields.
+func specFields(spec string) map[string]string {
+	// variable to store the fields from the specification
+	fields := make(map[string]string)
+
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) == 2 {
+			fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return fields
+}
+
+// validateCache verifies the cache exported from the build is
+// a registry reference or a directory within the workspace.
+func validateCache(cache string) error {
+	fields := specFields(cacheSpec(cache))
+
+	switch fields["type"] {
+	case cacheRegistry:
+		// verify the reference is provided
+		if len(fields["ref"]) == 0 {
+			return fmt.Errorf("no ref provided for build cache_to %s", cache)
+		}
+	case cacheLocal:
+		dest := fields["dest"]
+
+		// verify the directory is provided
+		if len(dest) == 0 {
+			return fmt.Errorf("no dest provided for build cache_to %s", cache)
+		}
+
+		// verify the directory is within the workspace
+		if filepath.IsAbs(dest) || strings.HasPrefix(filepath.Clean(dest), "..") {
+			return fmt.Errorf("build cache_to dest %s must be a relative path within the workspace", dest)
+		}
+	default:
+		return fmt.Errorf("invalid build cache_to type provided: %s", cache)
+	}
+
+	return nil
+}
+
+// cacheRef returns the registry reference for the cache derived
+// from the first tag with the tag replaced by the cache tag.
+func (b *Build) cacheRef() string {
+	tags := b.AllTags()
+
+	// check if a tag is provided
+	if len(tags) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%s", imageName(tags[0]), cacheTag)
+}
+
+// AllCacheFrom returns the BuildKit specifications for the cache
+// imported by the build including the cache derived from the tag.
+func (b *Build) AllCacheFrom() []string {
+	// variable to store the cache specifications
+	var caches []string
+
+	for _, cache := range b.CacheFrom {
+		caches = append(caches, cacheSpec(cache))
+	}
+
+	// check if the cache should be derived from the tag
+	if b.AutoCache && len(b.cacheRef()) > 0 {
+		cache := cacheSpec(b.cacheRef())
+
+		if !contains(caches, cache) {
+			caches = append(caches, cache)
+		}
+	}
+
+	return caches
+}
+
+// AllCacheTo returns the BuildKit specifications for the cache
+// exported by the build including the cache derived from the tag.
+func (b *Build) AllCacheTo() []string {
+	// variable to store the cache specifications
+	var caches []string
+
+	for _, cache := range b.CacheTo {
+		caches = append(caches, cacheSpec(cache))
+	}
+
+	// check if the cache should be derived from the tag
+	if b.AutoCache && len(b.cacheRef()) > 0 {
+		caches = append(caches, fmt.Sprintf("%s,mode=max", cacheSpec(b.cacheRef())))
+	}
+
+	return caches
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImg_cacheSpec(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		cache string
+		want  string
+	}{
+		{cache: "index.docker.io/target/vela-img:cache", want: "type=registry,ref=index.docker.io/target/vela-img:cache"},
+		{cache: "type=registry,ref=index.docker.io/target/vela-img:cache,mode=max", want: "type=registry,ref=index.docker.io/target/vela-img:cache,mode=max"},
+		{cache: "type=local,dest=.cache", want: "type=local,dest=.cache"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := cacheSpec(test.cache)
+
+		if got != test.want {
+			t.Errorf("cacheSpec for %s is %s, want %s", test.cache, got, test.want)
+		}
+	}
+}
+
+func TestImg_validateCache(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		cache   string
+		wantErr bool
+	}{
+		{cache: "index.docker.io/target/vela-img:cache", wantErr: false},
+		{cache: "type=registry,ref=index.docker.io/target/vela-img:cache,mode=max", wantErr: false},
+		{cache: "type=local,dest=.cache", wantErr: false},
+		{cache: "type=registry,mode=max", wantErr: true},
+		{cache: "type=local", wantErr: true},
+		{cache: "type=local,dest=/tmp/cache", wantErr: true},
+		{cache: "type=local,dest=../cache", wantErr: true},
+		{cache: "type=s3,bucket=cache", wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := validateCache(test.cache)
+
+		if test.wantErr && err == nil {
+			t.Errorf("validateCache for %s should have returned err", test.cache)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("validateCache for %s returned err: %v", test.cache, err)
+		}
+	}
+}
+
+func TestImg_Build_cacheRef(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		tags []string
+		want string
+	}{
+		{tags: nil, want: ""},
+		{tags: []string{"index.docker.io/target/vela-img:latest"}, want: "index.docker.io/target/vela-img:buildcache"},
+		{tags: []string{"localhost:5000/target/vela-img"}, want: "localhost:5000/target/vela-img:buildcache"},
+		{tags: []string{"localhost:5000/target/vela-img:v1@sha256:abc"}, want: "localhost:5000/target/vela-img:buildcache"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		b := &Build{Tags: test.tags}
+
+		got := b.cacheRef()
+
+		if got != test.want {
+			t.Errorf("cacheRef for %v is %s, want %s", test.tags, got, test.want)
+		}
+	}
+}
+
+func TestImg_Build_AllCache(t *testing.T) {
+	// setup types
+	b := &Build{
+		AutoCache: true,
+		CacheFrom: []string{"index.docker.io/target/vela-img:buildcache", "type=local,src=.cache"},
+		CacheTo:   []string{"type=local,dest=.cache"},
+		Tags:      []string{"index.docker.io/target/vela-img:latest"},
+	}
+
+	wantFrom := []string{
+		"type=registry,ref=index.docker.io/target/vela-img:buildcache",
+		"type=local,src=.cache",
+	}
+
+	if got := b.AllCacheFrom(); !reflect.DeepEqual(got, wantFrom) {
+		t.Errorf("AllCacheFrom is %v, want %v", got, wantFrom)
+	}
+
+	wantTo := []string{
+		"type=local,dest=.cache",
+		"type=registry,ref=index.docker.io/target/vela-img:buildcache,mode=max",
+	}
+
+	if got := b.AllCacheTo(); !reflect.DeepEqual(got, wantTo) {
+		t.Errorf("AllCacheTo is %v, want %v", got, wantTo)
+	}
+}
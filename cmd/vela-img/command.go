@@ -6,35 +6,40 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/go-vela/types/constants"
 	"github.com/sirupsen/logrus"
 )
 
 // _img is the path to the executable binary in the image.
 const _img = "/usr/bin/img"
 
-// execCmd is a helper function to
-// run the provided command.
-func execCmd(e *exec.Cmd) error {
-	logrus.Tracef("executing cmd %s", strings.Join(e.Args, " "))
+// printCmd is a helper function to output the provided
+// command with the provided secrets masked.
+func printCmd(e *exec.Cmd, secrets ...string) {
+	fmt.Println("$", mask(strings.Join(e.Args, " "), secrets...))
+}
 
-	// set command stdout to OS stdout
-	e.Stdout = os.Stdout
-	// set command stderr to OS stderr
-	e.Stderr = os.Stderr
+// mask is a helper function to replace the
+// provided secrets in the value with a mask.
+func mask(value string, secrets ...string) string {
+	for _, secret := range secrets {
+		// skip empty secrets to avoid masking every character
+		if len(secret) == 0 {
+			continue
+		}
 
-	// output "trace" string for command
-	fmt.Println("$", strings.Join(e.Args, " "))
+		value = strings.ReplaceAll(value, secret, constants.SecretMask)
+	}
 
-	return e.Run()
+	return value
 }
 
 // versionCmd is a helper function to output
 // the client and server version information.
-func versionCmd() *exec.Cmd {
+func versionCmd(i *Img) *exec.Cmd {
 	logrus.Trace("creating img version command")
 
 	// variable to store flags for command
@@ -43,5 +48,5 @@ func versionCmd() *exec.Cmd {
 	// add flag for version img command
 	flags = append(flags, "version")
 
-	return exec.Command(_img, flags...)
+	return i.Command(flags...)
 }
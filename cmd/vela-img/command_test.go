@@ -5,20 +5,13 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
 	"reflect"
 	"testing"
-)
-
-func TestImg_execCmd(t *testing.T) {
-	// setup types
-	e := exec.Command("echo", "hello")
 
-	err := execCmd(e)
-	if err != nil {
-		t.Errorf("execCmd returned err: %v", err)
-	}
-}
+	"github.com/go-vela/types/constants"
+)
 
 func TestImg_versionCmd(t *testing.T) {
 	// setup types
@@ -27,9 +20,21 @@ func TestImg_versionCmd(t *testing.T) {
 		"version",
 	)
 
-	got := versionCmd()
+	got := versionCmd(nil)
 
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("versionCmd is %v, want %v", got, want)
 	}
 }
+
+func TestImg_mask(t *testing.T) {
+	// setup types
+	value := "/usr/bin/img build --build-arg=TOKEN=superSecretToken ."
+
+	want := fmt.Sprintf("/usr/bin/img build --build-arg=TOKEN=%s .", constants.SecretMask)
+
+	got := mask(value, "", "superSecretToken")
+	if got != want {
+		t.Errorf("mask is %s, want %s", got, want)
+	}
+}
@@ -5,42 +5,78 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
-	"github.com/go-vela/types/constants"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/yaml"
 )
 
 const (
 	credentials = `%s:%s`
 
-	registryFile = `{
-  "auths": {
-    "%s": {
-      "auth": "%s"
-    }
-  }
-}`
+	loginAction = "login"
+
+	// _configPath is the default path to the Docker config.json file.
+	_configPath = "~/.docker/config.json"
+)
+
+const (
+	// loginExec authenticates with each registry by running img login.
+	loginExec = "exec"
+	// loginFile authenticates with each registry by writing the Docker config.json file.
+	loginFile = "file"
+	// loginExisting uses a pre-mounted Docker config.json file with no credentials.
+	loginExisting = "existing"
 )
 
+// registriesPath is the directory containing the
+// per-registry secrets mounted for the plugin.
+const registriesPath = "/vela/secrets/img/registries"
+
 // Config holds input parameters for the plugin.
 type Config struct {
+	// client sending requests to the Docker Registry API
+	Client *http.Client
+	// img binary authenticating with the Docker Registry
+	Img *Img
+	// Docker Registries communicated with over http
+	Insecure []string
+	// strategy for authenticating with the Docker Registry (exec|file|existing)
+	LoginMode string
 	// password for communication with the Docker Registry
 	Password string
 	// config path the docker json file exists for authentication
 	Path string
+	// additional Docker Registries to authenticate with
+	Registries []*Registry
+	// enforce credentials are provided for the Docker Registry
+	RequireLogin bool
 	// full url to Docker Registry
 	URL string
 	// user name for communication with the Docker Registry
 	Username string
 }
 
+// Registry holds the credentials for an additional Docker Registry.
+type Registry struct {
+	// password for communication with the Docker Registry
+	Password string `json:"password"`
+	// full url to Docker Registry
+	URL string `json:"registry"`
+	// user name for communication with the Docker Registry
+	Username string `json:"username"`
+}
+
 var (
 	appFS = afero.NewOsFs()
 
@@ -69,47 +105,318 @@ var (
 			EnvVars:  []string{"PARAMETER_PATH", "REGISTRY_PATH", "DOCKER_CONFIG_PATH", "DOCKER_CONFIG"},
 			FilePath: string("/vela/parameters/img/registry/path,/vela/secrets/img/registry/path,/vela/secrets/img/path"),
 			Name:     "config.path",
-			Usage:    "password for communication with the registry",
-			Value:    "~/.docker/config.json",
+			Usage:    "path to the directory or config.json file for the Docker config used for authentication",
+			Value:    _configPath,
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_LOGIN_MODE", "REGISTRY_LOGIN_MODE"},
+			FilePath: string("/vela/parameters/img/registry/login_mode,/vela/secrets/img/registry/login_mode"),
+			Name:     "config.login_mode",
+			Usage:    "strategy for authenticating with the registry - options: (exec|file|existing) - defaults to exec for the img backend and file for other backends",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_REQUIRE_LOGIN", "REGISTRY_REQUIRE_LOGIN"},
+			FilePath: string("/vela/parameters/img/registry/require_login,/vela/secrets/img/registry/require_login"),
+			Name:     "config.require_login",
+			Usage:    "enforce credentials are provided for the registry",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_REGISTRIES", "REGISTRY_REGISTRIES"},
+			FilePath: string("/vela/parameters/img/registry/registries,/vela/secrets/img/registry/registries"),
+			Name:     "config.registries",
+			Usage:    "JSON list of additional registries to communicate with",
+		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_INSECURE_REGISTRIES", "REGISTRY_INSECURE_REGISTRIES"},
+			FilePath: string("/vela/parameters/img/registry/insecure_registries,/vela/secrets/img/registry/insecure_registries"),
+			Name:     "config.insecure_registries",
+			Usage:    "registries to communicate with over http instead of https",
 		},
 	}
 )
 
-// Write creates a Docker config.json file for building and publishing the image.
-func (c *Config) Login() error {
+// Login authenticates with every Docker Registry provided
+// for the plugin based off the configured login mode.
+func (c *Config) Login(ctx context.Context) error {
 	logrus.Trace("logging in registry information")
 
+	switch c.LoginMode {
+	case loginFile:
+		return c.Write()
+	case loginExisting:
+		return c.Existing()
+	default:
+		for _, r := range c.registries() {
+			err := r.Login(ctx, c.Img)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Print outputs the commands for authenticating with every
+// Docker Registry based off the configured login mode.
+func (c *Config) Print() {
+	switch c.LoginMode {
+	case loginFile:
+		path, err := c.configFile()
+		if err != nil {
+			path = c.Path
+		}
+
+		logrus.Infof("registry credentials would be written to %s", path)
+	case loginExisting:
+		logrus.Info("existing registry configuration file would be used")
+	default:
+		for _, r := range c.registries() {
+			printCmd(r.Command(c.Img), r.Password)
+		}
+	}
+}
+
+// Existing verifies the pre-mounted Docker config.json file
+// exists and configures img to authenticate with it.
+func (c *Config) Existing() error {
+	logrus.Trace("using existing registry configuration file")
+
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	path, err := c.configFile()
+	if err != nil {
+		return err
+	}
+
+	exists, err := a.Exists(path)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("no existing config file found at %s", path)
+	}
+
+	// point img at the directory containing the config.json file
+	return os.Setenv("DOCKER_CONFIG", filepath.Dir(path))
+}
+
+// configFile returns the expanded path to the Docker config.json file.
+func (c *Config) configFile() (string, error) {
+	path := c.Path
+
+	// check if a path is provided
+	if len(path) == 0 {
+		path = _configPath
+	}
+
+	// check if the path should be expanded to the home directory
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to expand config path %s: %w", path, err)
+		}
+
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+
+	// check if the path is a directory like DOCKER_CONFIG
+	if filepath.Ext(path) != ".json" {
+		path = filepath.Join(path, "config.json")
+	}
+
+	// verify the file is named config.json since img only
+	// reads the config.json file from the DOCKER_CONFIG directory
+	if filepath.Base(path) != "config.json" {
+		return "", fmt.Errorf("invalid config path provided: %s must be a directory or a config.json file", c.Path)
+	}
+
+	return path, nil
+}
+
+// registries returns the primary Docker Registry
+// along with any additional registries provided.
+func (c *Config) registries() []*Registry {
+	// variable to store registries to authenticate with
+	var registries []*Registry
+
+	// check if name, username and password are provided
+	if len(c.URL) > 0 && len(c.Username) > 0 && len(c.Password) > 0 {
+		registries = append(registries, &Registry{
+			Password: c.Password,
+			URL:      c.URL,
+			Username: c.Username,
+		})
+	}
+
+	return append(registries, c.Registries...)
+}
+
+// Command formats and outputs the Login command from the provided
+// configuration to authenticate with the Docker Registry.
+//
+// The password is provided to img via stdin to avoid
+// exposing it in the arguments for the process.
+func (r *Registry) Command(i *Img) *exec.Cmd {
+	logrus.Trace("creating img login command from plugin configuration")
+
 	// variable to store flags for command
 	var flags []string
 
-	// check if name, username and password are provided
-	if len(c.URL) == 0 || len(c.Username) == 0 || len(c.Password) == 0 {
-		return nil
+	flags = append(flags, "--password-stdin")
+	flags = append(flags, fmt.Sprintf("-u=%s", r.Username))
+	flags = append(flags, r.URL)
+
+	e := i.Command(append([]string{loginAction}, flags...)...)
+
+	// set command stdin to the password
+	e.Stdin = strings.NewReader(r.Password)
+
+	return e
+}
+
+// Login authenticates with the Docker Registry.
+func (r *Registry) Login(ctx context.Context, i *Img) error {
+	logrus.Tracef("logging in to registry %s", r.URL)
+
+	// create the login command for the registry
+	cmd := r.Command(i)
+
+	// run the login command for the registry
+	_, err := i.Run(ctx, cmd, r.Password)
+
+	return err
+}
+
+// Validate verifies the Registry is properly configured.
+func (r *Registry) Validate() error {
+	logrus.Trace("validating registry plugin configuration")
+
+	// verify url is provided
+	if len(r.URL) == 0 {
+		return fmt.Errorf("no registry url provided")
+	}
+
+	// verify password are provided
+	if len(r.Password) == 0 {
+		return fmt.Errorf("no password provided for registry %s", r.URL)
+	}
+
+	// verify username is provided
+	if len(r.Username) == 0 {
+		return fmt.Errorf("no username provided for registry %s", r.URL)
+	}
+
+	return nil
+}
+
+// loadRegistries creates the list of additional Docker Registries from
+// the provided JSON input and the per-registry secrets mounted at
+// /vela/secrets/img/registries/<name>/{registry,username,password}.
+//
+// Credentials found in the secrets are used to fill in the
+// registries from the JSON input with a matching url.
+func loadRegistries(input string) ([]*Registry, error) {
+	logrus.Trace("loading registry information")
+
+	// variable to store registries provided
+	var registries []*Registry
+
+	// check if the JSON or YAML input is provided
+	if len(strings.TrimSpace(input)) > 0 {
+		// convert the input to JSON since YAML is a superset of JSON
+		data, err := yaml.YAMLToJSON([]byte(input))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse registries: %w", err)
+		}
+
+		err = json.Unmarshal(data, &registries)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse registries: %w", err)
+		}
+	}
+
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// check if the registry secrets exist
+	exists, err := a.DirExists(registriesPath)
+	if err != nil || !exists {
+		return registries, nil
+	}
+
+	entries, err := a.ReadDir(registriesPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registry secrets: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(registriesPath, entry.Name())
+
+		// the directory name is the registry url unless overridden
+		secret := &Registry{
+			Password: readSecret(a, filepath.Join(dir, "password")),
+			URL:      readSecret(a, filepath.Join(dir, "registry")),
+			Username: readSecret(a, filepath.Join(dir, "username")),
+		}
+
+		if len(secret.URL) == 0 {
+			secret.URL = entry.Name()
+		}
+
+		registries = mergeRegistry(registries, secret)
 	}
 
-	flags = append(flags, fmt.Sprintf("-p=%s", c.Password))
-	flags = append(flags, fmt.Sprintf("-u=%s", c.Username))
-	flags = append(flags, c.URL)
+	return registries, nil
+}
 
-	//nolint:gosec // false pos
-	e := exec.Command(_img, append([]string{"login"}, flags...)...)
+// mergeRegistry fills in the credentials for a registry
+// with a matching url or appends it to the list.
+func mergeRegistry(registries []*Registry, secret *Registry) []*Registry {
+	for _, r := range registries {
+		if r.URL != secret.URL {
+			continue
+		}
 
-	// set command stdout to OS stdout
-	e.Stdout = os.Stdout
-	// set command stderr to OS stderr
-	e.Stderr = os.Stderr
+		if len(r.Username) == 0 {
+			r.Username = secret.Username
+		}
 
-	cmd := strings.ReplaceAll(strings.Join(e.Args, " "), c.Password, constants.SecretMask)
+		if len(r.Password) == 0 {
+			r.Password = secret.Password
+		}
 
-	fmt.Println("$", cmd)
+		return registries
+	}
 
-	return e.Run()
+	return append(registries, secret)
+}
+
+// readSecret returns the trimmed contents of the secret
+// file or an empty string if it can not be read.
+func readSecret(a *afero.Afero, path string) string {
+	data, err := a.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
 }
 
 // Write creates a Docker config.json file for building and publishing the image.
 //
-// This function is not being used but keeping around incase the file approach
-// becomes more viable.
+// Credentials for each registry are merged into the existing
+// auths in the file and img is configured to authenticate with it.
 func (c *Config) Write() error {
 	logrus.Trace("writing registry configuration file")
 
@@ -118,43 +425,203 @@ func (c *Config) Write() error {
 		Fs: appFS,
 	}
 
-	// check if name, username and password are provided
-	if len(c.URL) == 0 || len(c.Username) == 0 || len(c.Password) == 0 {
-		return nil
+	path, err := c.configFile()
+	if err != nil {
+		return err
 	}
 
-	// create basic authentication string for config.json file
-	basicAuth := base64.StdEncoding.EncodeToString(
-		[]byte(fmt.Sprintf(credentials, c.Username, c.Password)),
-	)
+	// variable to store the contents of the config.json file
+	file := make(map[string]json.RawMessage)
+	// variable to store the auths from the config.json file
+	auths := make(map[string]map[string]interface{})
 
-	// create output string for config.json file
-	out := fmt.Sprintf(
-		registryFile,
-		c.URL,
-		basicAuth,
-	)
+	// check if the config.json file already exists
+	data, err := a.ReadFile(path)
+	if err == nil && len(data) > 0 {
+		err = json.Unmarshal(data, &file)
+		if err != nil {
+			return fmt.Errorf("unable to parse config file %s: %w", path, err)
+		}
+
+		if raw, ok := file["auths"]; ok {
+			err = json.Unmarshal(raw, &auths)
+			if err != nil {
+				return fmt.Errorf("unable to parse auths in config file %s: %w", path, err)
+			}
+		}
+	}
+
+	for _, r := range c.registries() {
+		// create basic authentication string for config.json file
+		basicAuth := base64.StdEncoding.EncodeToString(
+			[]byte(fmt.Sprintf(credentials, r.Username, r.Password)),
+		)
+
+		if auths[r.URL] == nil {
+			auths[r.URL] = make(map[string]interface{})
+		}
+
+		auths[r.URL]["auth"] = basicAuth
+	}
+
+	file["auths"], err = json.Marshal(auths)
+	if err != nil {
+		return err
+	}
+
+	// create output for config.json file
+	out, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = a.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
 
-	return a.WriteFile(c.Path, []byte(out), 0644)
+	err = a.WriteFile(path, out, 0600)
+	if err != nil {
+		return err
+	}
+
+	// point img at the directory containing the config.json file
+	return os.Setenv("DOCKER_CONFIG", filepath.Dir(path))
+}
+
+// auth returns the credentials for the registry host from the
+// registries provided or the existing Docker config.json file.
+func (c *Config) auth(host string) (string, string) {
+	for _, r := range c.registries() {
+		if registryHost(r.URL) == host {
+			return r.Username, r.Password
+		}
+	}
+
+	// check if the existing config.json file is used
+	if c.LoginMode != loginExisting {
+		return "", ""
+	}
+
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	path, err := c.configFile()
+	if err != nil {
+		return "", ""
+	}
+
+	data, err := a.ReadFile(path)
+	if err != nil {
+		return "", ""
+	}
+
+	// variable to store the auths from the config.json file
+	var file struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		logrus.Warnf("unable to parse config file %s: %v", path, err)
+
+		return "", ""
+	}
+
+	for url, auth := range file.Auths {
+		if registryHost(url) != host {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			continue
+		}
+
+		username, password, _ := strings.Cut(string(decoded), ":")
+
+		return username, password
+	}
+
+	return "", ""
+}
+
+// execLogin checks if img login is run to authenticate
+// with at least one Docker Registry.
+func (c *Config) execLogin() bool {
+	switch c.LoginMode {
+	case loginFile, loginExisting:
+		return false
+	default:
+		return len(c.registries()) > 0
+	}
+}
+
+// Authenticated checks if the Config provides
+// a way to authenticate with a Docker Registry.
+func (c *Config) Authenticated() bool {
+	return c.LoginMode == loginExisting || len(c.registries()) > 0
 }
 
 // Validate verifies the Config is properly configured.
 func (c *Config) Validate() error {
 	logrus.Trace("validating config plugin configuration")
 
-	// verify password are provided
-	if len(c.Password) == 0 {
-		return fmt.Errorf("no config password provided")
+	switch c.LoginMode {
+	case "", loginExec:
+	case loginFile:
+		// verify the config.json file can be written
+		_, err := c.configFile()
+		if err != nil {
+			return err
+		}
+	case loginExisting:
+		// verify no credentials are provided
+		if len(c.Username) > 0 || len(c.Password) > 0 || len(c.Registries) > 0 {
+			return fmt.Errorf("no credentials should be provided for config login mode %s", c.LoginMode)
+		}
+
+		// verify the config.json file can be read
+		_, err := c.configFile()
+
+		return err
+	default:
+		return fmt.Errorf("invalid config login mode provided: %s", c.LoginMode)
 	}
 
-	// verify url is provided
-	if len(c.URL) == 0 {
-		return fmt.Errorf("no config url provided")
+	// check if credentials are provided for the primary registry
+	if len(c.Username) > 0 || len(c.Password) > 0 {
+		// verify password are provided
+		if len(c.Password) == 0 {
+			return fmt.Errorf("no config password provided")
+		}
+
+		// verify url is provided
+		if len(c.URL) == 0 {
+			return fmt.Errorf("no config url provided")
+		}
+
+		// verify username is provided
+		if len(c.Username) == 0 {
+			return fmt.Errorf("no config username provided")
+		}
 	}
 
-	// verify username is provided
-	if len(c.Username) == 0 {
-		return fmt.Errorf("no config username provided")
+	// verify credentials are provided when login is required
+	if c.RequireLogin && !c.Authenticated() {
+		return fmt.Errorf("no config credentials provided")
+	}
+
+	// verify additional registries are provided
+	for _, r := range c.Registries {
+		err := r.Validate()
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -5,6 +5,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -27,6 +34,45 @@ func TestImg_Config_Login(t *testing.T) {
 	}
 }
 
+func TestImg_Config_Login_Exec(t *testing.T) {
+	// setup types
+	r := new(fakeRunner)
+
+	c := &Config{
+		Img:      &Img{Runner: r},
+		Password: "superSecretPassword",
+		Registries: []*Registry{
+			{
+				Password: "superSecretGitHubPassword",
+				URL:      "ghcr.io",
+				Username: "octocat",
+			},
+		},
+		URL:      "index.docker.io",
+		Username: "octocat",
+	}
+
+	err := c.Login(context.Background())
+	if err != nil {
+		t.Errorf("Login returned err: %v", err)
+	}
+
+	want := [][]string{
+		{_img, loginAction, "--password-stdin", "-u=octocat", "index.docker.io"},
+		{_img, loginAction, "--password-stdin", "-u=octocat", "ghcr.io"},
+	}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Login calls are %v, want %v", r.calls, want)
+	}
+
+	stdin := []string{"superSecretPassword", "superSecretGitHubPassword"}
+
+	if !reflect.DeepEqual(r.stdin, stdin) {
+		t.Errorf("Login stdin is %v, want %v", r.stdin, stdin)
+	}
+}
+
 func TestImg_Config_Login_NoName(t *testing.T) {
 	// setup filesystem
 	appFS = afero.NewMemMapFs()
@@ -130,3 +176,509 @@ func TestImg_Config_Validate_NoUsername(t *testing.T) {
 		t.Errorf("Validate should have returned err")
 	}
 }
+
+func TestImg_Config_Validate_Registries(t *testing.T) {
+	// setup types
+	c := &Config{
+		Password: "superSecretPassword",
+		Registries: []*Registry{
+			{
+				Password: "superSecretPassword",
+				URL:      "artifactory.example.com",
+				Username: "octocat",
+			},
+		},
+		URL:      "index.docker.io",
+		Username: "octocat",
+	}
+
+	err := c.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Config_Validate_RegistryNoPassword(t *testing.T) {
+	// setup types
+	c := &Config{
+		Password: "superSecretPassword",
+		Registries: []*Registry{
+			{
+				URL:      "artifactory.example.com",
+				Username: "octocat",
+			},
+		},
+		URL:      "index.docker.io",
+		Username: "octocat",
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Config_registries(t *testing.T) {
+	// setup types
+	c := &Config{
+		Password: "superSecretPassword",
+		Registries: []*Registry{
+			{
+				Password: "otherSecretPassword",
+				URL:      "artifactory.example.com",
+				Username: "octocat",
+			},
+		},
+		URL:      "index.docker.io",
+		Username: "octocat",
+	}
+
+	want := []*Registry{
+		{
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		{
+			Password: "otherSecretPassword",
+			URL:      "artifactory.example.com",
+			Username: "octocat",
+		},
+	}
+
+	got := c.registries()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("registries is %v, want %v", got, want)
+	}
+}
+
+func TestImg_loadRegistries(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	_ = a.WriteFile("/vela/secrets/img/registries/artifactory/registry", []byte("artifactory.example.com\n"), 0644)
+	_ = a.WriteFile("/vela/secrets/img/registries/artifactory/password", []byte("superSecretPassword\n"), 0644)
+	_ = a.WriteFile("/vela/secrets/img/registries/mirror.example.com/username", []byte("mirror"), 0644)
+	_ = a.WriteFile("/vela/secrets/img/registries/mirror.example.com/password", []byte("mirrorPassword"), 0644)
+
+	want := []*Registry{
+		{
+			Password: "superSecretPassword",
+			URL:      "artifactory.example.com",
+			Username: "octocat",
+		},
+		{
+			Password: "mirrorPassword",
+			URL:      "mirror.example.com",
+			Username: "mirror",
+		},
+	}
+
+	got, err := loadRegistries(`[{"registry": "artifactory.example.com", "username": "octocat"}]`)
+	if err != nil {
+		t.Errorf("loadRegistries returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadRegistries is %v, want %v", got, want)
+	}
+}
+
+func TestImg_loadRegistries_YAML(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	want := []*Registry{
+		{
+			Password: "superSecretPassword",
+			URL:      "artifactory.example.com",
+			Username: "octocat",
+		},
+	}
+
+	got, err := loadRegistries(`
+- registry: artifactory.example.com
+  username: octocat
+  password: superSecretPassword
+`)
+	if err != nil {
+		t.Errorf("loadRegistries returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadRegistries is %v, want %v", got, want)
+	}
+}
+
+func TestImg_loadRegistries_Invalid(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_, err := loadRegistries("not json")
+	if err == nil {
+		t.Errorf("loadRegistries should have returned err")
+	}
+}
+
+func TestImg_Registry_Command(t *testing.T) {
+	// setup types
+	r := &Registry{
+		Password: "superSecretPassword",
+		URL:      "index.docker.io",
+		Username: "octocat",
+	}
+
+	want := []string{
+		_img,
+		loginAction,
+		"--password-stdin",
+		"-u=octocat",
+		"index.docker.io",
+	}
+
+	got := r.Command(nil)
+
+	if !reflect.DeepEqual(got.Args, want) {
+		t.Errorf("Command args are %v, want %v", got.Args, want)
+	}
+
+	for _, arg := range got.Args {
+		if strings.Contains(arg, r.Password) {
+			t.Errorf("Command args contain password: %v", got.Args)
+		}
+	}
+
+	stdin, err := io.ReadAll(got.Stdin)
+	if err != nil {
+		t.Errorf("unable to read stdin: %v", err)
+	}
+
+	if string(stdin) != r.Password {
+		t.Errorf("Command stdin is %s, want %s", stdin, r.Password)
+	}
+}
+
+func TestImg_Config_Write_NoSecretInArgs(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// restore the config directory modified by Write
+	t.Setenv("DOCKER_CONFIG", "")
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// setup types
+	c := &Config{
+		Password: "superSecretPassword",
+		Path:     "/root/.docker/config.json",
+		URL:      "index.docker.io",
+		Username: "octocat",
+	}
+
+	err := c.Write()
+	if err != nil {
+		t.Errorf("Write returned err: %v", err)
+	}
+
+	data, err := a.ReadFile(c.Path)
+	if err != nil {
+		t.Errorf("unable to read config file: %v", err)
+	}
+
+	if got := os.Getenv("DOCKER_CONFIG"); got != "/root/.docker" {
+		t.Errorf("DOCKER_CONFIG is %s, want /root/.docker", got)
+	}
+
+	if strings.Contains(string(data), c.Password) {
+		t.Errorf("config file contains plaintext password: %s", data)
+	}
+
+	for _, r := range c.registries() {
+		for _, arg := range r.Command(nil).Args {
+			if strings.Contains(arg, c.Password) {
+				t.Errorf("Command args contain password: %v", r.Command(nil).Args)
+			}
+		}
+	}
+}
+
+func TestImg_Config_Write_Merge(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// restore the config directory modified by Login
+	t.Setenv("DOCKER_CONFIG", "")
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	_ = a.WriteFile("/root/.docker/config.json", []byte(`{
+  "auths": {
+    "mirror.example.com": {
+      "auth": "bWlycm9yOm1pcnJvclBhc3N3b3Jk"
+    }
+  },
+  "credsStore": "desktop"
+}`), 0600)
+
+	// setup types
+	c := &Config{
+		LoginMode: loginFile,
+		Password:  "superSecretPassword",
+		Path:      "/root/.docker/config.json",
+		URL:       "index.docker.io",
+		Username:  "octocat",
+	}
+
+	err := c.Login(context.Background())
+	if err != nil {
+		t.Errorf("Login returned err: %v", err)
+	}
+
+	data, err := a.ReadFile(c.Path)
+	if err != nil {
+		t.Errorf("unable to read config file: %v", err)
+	}
+
+	got := struct {
+		Auths      map[string]map[string]string `json:"auths"`
+		CredsStore string                       `json:"credsStore"`
+	}{}
+
+	err = json.Unmarshal(data, &got)
+	if err != nil {
+		t.Errorf("unable to parse config file: %v", err)
+	}
+
+	if got.Auths["mirror.example.com"]["auth"] != "bWlycm9yOm1pcnJvclBhc3N3b3Jk" {
+		t.Errorf("config file is missing existing auth: %s", data)
+	}
+
+	if got.Auths["index.docker.io"]["auth"] != "b2N0b2NhdDpzdXBlclNlY3JldFBhc3N3b3Jk" {
+		t.Errorf("config file is missing registry auth: %s", data)
+	}
+
+	if got.CredsStore != "desktop" {
+		t.Errorf("config file is missing existing settings: %s", data)
+	}
+}
+
+func TestImg_Config_Login_Existing(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// restore the config directory modified by Login
+	t.Setenv("DOCKER_CONFIG", "")
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// setup types
+	c := &Config{
+		LoginMode: loginExisting,
+		Path:      "/root/.docker",
+	}
+
+	err := c.Login(context.Background())
+	if err == nil {
+		t.Errorf("Login should have returned err")
+	}
+
+	_ = a.WriteFile("/root/.docker/config.json", []byte(`{}`), 0600)
+
+	err = c.Login(context.Background())
+	if err != nil {
+		t.Errorf("Login returned err: %v", err)
+	}
+}
+
+func TestImg_Config_auth(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_ = afero.WriteFile(appFS, "/root/.docker/config.json", []byte(`{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "b2N0b2NhdDpzdXBlclNlY3JldFBhc3N3b3Jk"}
+  }
+}`), 0600)
+
+	// setup tests
+	tests := []struct {
+		config   *Config
+		host     string
+		username string
+	}{
+		{
+			config: &Config{
+				Password:   "superSecretPassword",
+				Registries: []*Registry{{Password: "ghcrPassword", URL: "ghcr.io", Username: "hubot"}},
+				URL:        "index.docker.io",
+				Username:   "octocat",
+			},
+			host:     "ghcr.io",
+			username: "hubot",
+		},
+		{
+			config:   &Config{LoginMode: loginExisting, Path: "/root/.docker"},
+			host:     _dockerHub,
+			username: "octocat",
+		},
+		{
+			config: &Config{LoginMode: loginExisting, Path: "/root/.docker"},
+			host:   "ghcr.io",
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got, _ := test.config.auth(test.host)
+
+		if got != test.username {
+			t.Errorf("auth for %s is %s, want %s", test.host, got, test.username)
+		}
+	}
+}
+
+func TestImg_Config_configFile(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("unable to determine home directory: %v", err)
+	}
+
+	// setup tests
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "", want: filepath.Join(home, ".docker", "config.json")},
+		{path: "~/.docker/config.json", want: filepath.Join(home, ".docker", "config.json")},
+		{path: "/kaniko/.docker", want: "/kaniko/.docker/config.json"},
+		{path: "/tmp/docker/config.json", want: "/tmp/docker/config.json"},
+		{path: "/tmp/auth.json", wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		c := &Config{
+			Path: test.path,
+		}
+
+		got, err := c.configFile()
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("configFile for %s should have returned err", test.path)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("configFile returned err: %v", err)
+		}
+
+		if got != test.want {
+			t.Errorf("configFile is %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestImg_Config_Validate_LoginMode(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		config  *Config
+		wantErr bool
+	}{
+		{
+			config: &Config{
+				LoginMode: loginFile,
+				Password:  "superSecretPassword",
+				URL:       "index.docker.io",
+				Username:  "octocat",
+			},
+			wantErr: false,
+		},
+		{
+			config: &Config{
+				LoginMode: loginExisting,
+				URL:       "index.docker.io",
+			},
+			wantErr: false,
+		},
+		{
+			config: &Config{
+				LoginMode: loginExisting,
+				Password:  "superSecretPassword",
+				URL:       "index.docker.io",
+				Username:  "octocat",
+			},
+			wantErr: true,
+		},
+		{
+			config: &Config{
+				LoginMode: loginFile,
+				Password:  "superSecretPassword",
+				Path:      "/tmp/auth.json",
+				URL:       "index.docker.io",
+				Username:  "octocat",
+			},
+			wantErr: true,
+		},
+		{
+			config: &Config{
+				LoginMode: "foo",
+				Password:  "superSecretPassword",
+				URL:       "index.docker.io",
+				Username:  "octocat",
+			},
+			wantErr: true,
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := test.config.Validate()
+
+		if test.wantErr && err == nil {
+			t.Errorf("Validate should have returned err for %s", test.config.LoginMode)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("Validate returned err for %s: %v", test.config.LoginMode, err)
+		}
+	}
+}
+
+func TestImg_Config_Validate_Anonymous(t *testing.T) {
+	// setup types
+	c := &Config{
+		URL: "index.docker.io",
+	}
+
+	err := c.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Config_Validate_RequireLogin(t *testing.T) {
+	// setup types
+	c := &Config{
+		RequireLogin: true,
+		URL:          "index.docker.io",
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// listAction outputs the images stored by img.
+const listAction = "ls"
+
+// listDigest returns the digest for the image from
+// the table of images output by the img ls command.
+func listDigest(out []byte, image string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		// skip the header and any rows without a digest
+		if len(fields) < 2 || !strings.HasPrefix(fields[len(fields)-1], "sha256:") {
+			continue
+		}
+
+		// check if the row is for the image
+		if normalizeImage(fields[0]) == normalizeImage(image) {
+			return fields[len(fields)-1], nil
+		}
+	}
+
+	return "", fmt.Errorf("no digest found for image %s", image)
+}
+
+// metadataDigest returns the digest for the image
+// from the metadata file written by BuildKit.
+func metadataDigest(path string) (string, error) {
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	data, err := a.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	// variable to store the metadata from the file
+	metadata := make(map[string]interface{})
+
+	err = json.Unmarshal(data, &metadata)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse metadata file %s: %w", path, err)
+	}
+
+	digest, ok := metadata["containerimage.digest"].(string)
+	if !ok || len(digest) == 0 {
+		return "", fmt.Errorf("no digest found in metadata file %s", path)
+	}
+
+	return digest, nil
+}
+
+// fileDigest returns the digest for the image
+// from the digest file written by kaniko.
+func fileDigest(path string) (string, error) {
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	data, err := a.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	digest := strings.TrimSpace(string(data))
+	if len(digest) == 0 {
+		return "", fmt.Errorf("no digest found in digest file %s", path)
+	}
+
+	return digest, nil
+}
+
+// normalizeImage converts the image to the fully qualified
+// form including the registry and the default tag.
+func normalizeImage(image string) string {
+	// replace the legacy registry for Docker Hub
+	image = strings.TrimPrefix(image, "index.docker.io/")
+
+	parts := strings.SplitN(image, "/", 2)
+
+	// check if the image includes a registry
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		// check if the image is an official image
+		if len(parts) == 1 {
+			image = "library/" + image
+		}
+
+		image = "docker.io/" + image
+	}
+
+	// check if the image includes a tag or digest
+	if imageName(image) == image {
+		image += ":latest"
+	}
+
+	return image
+}
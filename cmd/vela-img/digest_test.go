@@ -0,0 +1,130 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestImg_listDigest(t *testing.T) {
+	// setup types
+	out := []byte(`NAME                                        SIZE      CREATED AT      UPDATED AT      DIGEST
+docker.io/library/alpine:latest             2.7MiB    3 minutes ago   3 minutes ago   sha256:def456
+docker.io/target/vela-img:latest            3.2MiB    2 seconds ago   2 seconds ago   sha256:abc123
+localhost:5000/target/vela-img:v1           3.2MiB    2 seconds ago   2 seconds ago   sha256:789abc
+`)
+
+	// setup tests
+	tests := []struct {
+		image   string
+		want    string
+		wantErr bool
+	}{
+		{image: "target/vela-img", want: "sha256:abc123"},
+		{image: "index.docker.io/target/vela-img:latest", want: "sha256:abc123"},
+		{image: "alpine", want: "sha256:def456"},
+		{image: "localhost:5000/target/vela-img:v1", want: "sha256:789abc"},
+		{image: "target/vela-img:v1", wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got, err := listDigest(out, test.image)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("listDigest for %s should have returned err", test.image)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("listDigest for %s returned err: %v", test.image, err)
+		}
+
+		if got != test.want {
+			t.Errorf("listDigest for %s is %s, want %s", test.image, got, test.want)
+		}
+	}
+}
+
+func TestImg_metadataDigest(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	_ = a.WriteFile("/tmp/metadata.json", []byte(`{"containerimage.digest": "sha256:abc123", "image.name": "target/vela-img"}`), 0644)
+	_ = a.WriteFile("/tmp/empty.json", []byte(`{}`), 0644)
+
+	got, err := metadataDigest("/tmp/metadata.json")
+	if err != nil {
+		t.Errorf("metadataDigest returned err: %v", err)
+	}
+
+	if got != "sha256:abc123" {
+		t.Errorf("metadataDigest is %s, want sha256:abc123", got)
+	}
+
+	_, err = metadataDigest("/tmp/empty.json")
+	if err == nil {
+		t.Errorf("metadataDigest should have returned err")
+	}
+}
+
+func TestImg_fileDigest(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	_ = a.WriteFile("/tmp/digest", []byte("sha256:abc123\n"), 0644)
+	_ = a.WriteFile("/tmp/empty", nil, 0644)
+
+	got, err := fileDigest("/tmp/digest")
+	if err != nil {
+		t.Errorf("fileDigest returned err: %v", err)
+	}
+
+	if got != "sha256:abc123" {
+		t.Errorf("fileDigest is %s, want sha256:abc123", got)
+	}
+
+	_, err = fileDigest("/tmp/empty")
+	if err == nil {
+		t.Errorf("fileDigest should have returned err")
+	}
+}
+
+func TestImg_normalizeImage(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "alpine", want: "docker.io/library/alpine:latest"},
+		{image: "target/vela-img:v1", want: "docker.io/target/vela-img:v1"},
+		{image: "index.docker.io/target/vela-img", want: "docker.io/target/vela-img:latest"},
+		{image: "ghcr.io/target/vela-img:v1", want: "ghcr.io/target/vela-img:v1"},
+		{image: "localhost/vela-img", want: "localhost/vela-img:latest"},
+		{image: "localhost:5000/vela-img@sha256:abc123", want: "localhost:5000/vela-img@sha256:abc123"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := normalizeImage(test.image)
+
+		if got != test.want {
+			t.Errorf("normalizeImage for %s is %s, want %s", test.image, got, test.want)
+		}
+	}
+}
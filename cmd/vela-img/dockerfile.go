@@ -0,0 +1,369 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// maxDockerfile is the maximum size of a Dockerfile read for the build.
+const maxDockerfile = 4 << 20
+
+// heredoc matches the start of a heredoc in an instruction (e.g. <<EOF or <<-"EOF").
+var heredoc = regexp.MustCompile(`<<(-?)["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+
+// instruction represents an instruction parsed from a Dockerfile.
+type instruction struct {
+	// command for the instruction in upper case (e.g. FROM)
+	Command string
+	// flags provided to the instruction (e.g. --platform=linux/amd64)
+	Flags []string
+	// arguments provided to the instruction after the flags
+	Args []string
+	// indicates the arguments are provided in the JSON form
+	JSON bool
+	// text for the instruction after the command including heredocs
+	Value string
+	// line the instruction starts on
+	Line int
+}
+
+// Flag returns the value for the flag provided to the instruction.
+func (i *instruction) Flag(name string) (string, bool) {
+	for _, flag := range i.Flags {
+		key, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+
+		if key == name {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// stage represents a build stage parsed from a Dockerfile.
+type stage struct {
+	// image the stage is built from with the arguments expanded
+	Image string
+	// name of the stage from the AS keyword
+	Name string
+	// platform provided for the stage
+	Platform string
+	// line the stage starts on
+	Line int
+	// indicates the image is a previous stage or scratch
+	Internal bool
+}
+
+// dockerfile represents the instructions parsed from a Dockerfile.
+type dockerfile struct {
+	// instructions in the order they appear
+	Instructions []*instruction
+}
+
+// dockerfilePath returns the path to the Dockerfile for the Build.
+func (b *Build) dockerfilePath() string {
+	// check if File is provided
+	if len(b.File) > 0 {
+		return b.File
+	}
+
+	return filepath.Join(b.Directory, "Dockerfile")
+}
+
+// readDockerfile reads and parses the Dockerfile at the path.
+func readDockerfile(path string) (*dockerfile, error) {
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	info, err := a.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Dockerfile %s: %w", path, err)
+	}
+
+	// verify the file is a reasonable size for a Dockerfile
+	if info.Size() > maxDockerfile {
+		return nil, fmt.Errorf("dockerfile %s exceeds %d bytes", path, maxDockerfile)
+	}
+
+	data, err := a.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Dockerfile %s: %w", path, err)
+	}
+
+	d, err := parseDockerfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Dockerfile %s: %w", path, err)
+	}
+
+	return d, nil
+}
+
+// parseDockerfile parses the instructions from the Dockerfile
+// including line continuations, comments, the escape parser
+// directive and heredocs.
+func parseDockerfile(data []byte) (*dockerfile, error) {
+	// variable to store the lines from the file
+	var lines []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxDockerfile)
+
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	escape := parseEscape(lines)
+
+	d := new(dockerfile)
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		// skip empty lines and comments
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		start := i + 1
+
+		// join the lines ending with the escape character
+		for strings.HasSuffix(line, escape) && i+1 < len(lines) {
+			line = strings.TrimSuffix(line, escape)
+
+			i++
+
+			next := strings.TrimSpace(lines[i])
+
+			// comments are removed from the continued instruction
+			if strings.HasPrefix(next, "#") {
+				line += escape
+
+				continue
+			}
+
+			line += " " + next
+		}
+
+		line = strings.TrimSuffix(line, escape)
+
+		command, value, _ := strings.Cut(line, " ")
+
+		inst := &instruction{
+			Command: strings.ToUpper(command),
+			Value:   strings.TrimSpace(value),
+			Line:    start,
+		}
+
+		// append the contents for each heredoc to the instruction
+		for _, match := range heredocs(inst) {
+			strip, word := match[1] == "-", match[2]
+
+			for {
+				i++
+
+				if i >= len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated heredoc %s", start, word)
+				}
+
+				body := lines[i]
+
+				// check if the heredoc strips leading tabs
+				if strip {
+					body = strings.TrimLeft(body, "\t")
+				}
+
+				if body == word {
+					break
+				}
+
+				inst.Value += "\n" + body
+			}
+		}
+
+		parseArgs(inst)
+
+		d.Instructions = append(d.Instructions, inst)
+	}
+
+	return d, nil
+}
+
+// heredocs returns the heredocs started by the instruction.
+func heredocs(inst *instruction) [][]string {
+	// check if the instruction supports heredocs
+	switch inst.Command {
+	case "RUN", "COPY", "ADD":
+	default:
+		return nil
+	}
+
+	// variable to store the heredocs
+	var matches [][]string
+
+	for _, index := range heredoc.FindAllStringSubmatchIndex(inst.Value, -1) {
+		// skip here-strings for the shell (e.g. <<<word)
+		if index[0] > 0 && inst.Value[index[0]-1] == '<' {
+			continue
+		}
+
+		matches = append(matches, []string{
+			inst.Value[index[0]:index[1]],
+			inst.Value[index[2]:index[3]],
+			inst.Value[index[4]:index[5]],
+		})
+	}
+
+	return matches
+}
+
+// parseEscape returns the escape character from the parser directives
+// at the start of the Dockerfile or the default backslash.
+func parseEscape(lines []string) string {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		// check if the line is a parser directive
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		key, value, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "#")), "=")
+		if !ok {
+			break
+		}
+
+		if strings.EqualFold(strings.TrimSpace(key), "escape") {
+			if value = strings.TrimSpace(value); value == "`" {
+				return value
+			}
+		}
+	}
+
+	return `\`
+}
+
+// parseArgs splits the value for the instruction into the flags and arguments.
+func parseArgs(inst *instruction) {
+	// only the first line is split since heredoc contents are not arguments
+	first := strings.SplitN(inst.Value, "\n", 2)[0]
+
+	fields := strings.Fields(first)
+
+	// capture the flags provided before the arguments
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+		inst.Flags = append(inst.Flags, fields[0])
+		fields = fields[1:]
+	}
+
+	rest := strings.TrimSpace(strings.Join(fields, " "))
+
+	// check if the arguments are provided in the JSON form
+	if strings.HasPrefix(rest, "[") {
+		var args []string
+
+		if json.Unmarshal([]byte(rest), &args) == nil {
+			inst.Args = args
+			inst.JSON = true
+
+			return
+		}
+	}
+
+	inst.Args = fields
+}
+
+// Stages returns the build stages from the Dockerfile with the
+// arguments in the images expanded from the global arguments
+// and the build args in the 'KEY=VALUE' format.
+func (d *dockerfile) Stages(buildArgs []string) []*stage {
+	// variable to store the values for the arguments
+	args := make(map[string]string)
+
+	// variable to store the values provided by the build args
+	overrides := make(map[string]string)
+
+	for _, arg := range buildArgs {
+		key, value, _ := strings.Cut(arg, "=")
+
+		overrides[key] = value
+	}
+
+	// variable to store the stages
+	var stages []*stage
+
+	// variable to store the names of the stages
+	names := make(map[string]bool)
+
+	for _, inst := range d.Instructions {
+		switch inst.Command {
+		case "ARG":
+			// only the arguments before the first stage apply to the images
+			if len(stages) > 0 {
+				continue
+			}
+
+			for _, arg := range inst.Args {
+				key, value, _ := strings.Cut(arg, "=")
+
+				// check if the value is provided by the build args
+				if override, ok := overrides[key]; ok {
+					value = override
+				}
+
+				args[key] = strings.Trim(value, `"'`)
+			}
+		case "FROM":
+			s := &stage{Line: inst.Line}
+
+			// check if an image is provided
+			if len(inst.Args) > 0 {
+				s.Image = os.Expand(inst.Args[0], func(key string) string {
+					// check if a default is provided for the argument
+					if key, value, ok := strings.Cut(key, ":-"); ok {
+						if len(args[key]) == 0 {
+							return value
+						}
+
+						return args[key]
+					}
+
+					return args[key]
+				})
+			}
+
+			// check if the stage is named
+			if len(inst.Args) > 2 && strings.EqualFold(inst.Args[1], "AS") {
+				s.Name = strings.ToLower(inst.Args[2])
+			}
+
+			s.Platform, _ = inst.Flag("platform")
+			s.Internal = strings.EqualFold(s.Image, "scratch") || names[strings.ToLower(s.Image)]
+
+			if len(s.Name) > 0 {
+				names[s.Name] = true
+			}
+
+			stages = append(stages, s)
+		}
+	}
+
+	return stages
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestImg_parseDockerfile(t *testing.T) {
+	// setup types
+	data := []byte(`# syntax=docker/dockerfile:1
+FROM --platform=$BUILDPLATFORM golang:1.18 AS builder
+
+RUN go build \
+  # comments are removed from continued instructions
+  -o /bin/app .
+
+COPY <<EOF /etc/app.conf
+debug = true
+EOF
+
+run cat <<<"here-string"
+
+CMD ["/bin/app", "--debug"]
+`)
+
+	want := []*instruction{
+		{
+			Command: "FROM",
+			Flags:   []string{"--platform=$BUILDPLATFORM"},
+			Args:    []string{"golang:1.18", "AS", "builder"},
+			Value:   "--platform=$BUILDPLATFORM golang:1.18 AS builder",
+			Line:    2,
+		},
+		{
+			Command: "RUN",
+			Args:    []string{"go", "build", "-o", "/bin/app", "."},
+			Value:   "go build  -o /bin/app .",
+			Line:    4,
+		},
+		{
+			Command: "COPY",
+			Args:    []string{"<<EOF", "/etc/app.conf"},
+			Value:   "<<EOF /etc/app.conf\ndebug = true",
+			Line:    8,
+		},
+		{
+			Command: "RUN",
+			Args:    []string{"cat", `<<<"here-string"`},
+			Value:   `cat <<<"here-string"`,
+			Line:    12,
+		},
+		{
+			Command: "CMD",
+			Args:    []string{"/bin/app", "--debug"},
+			JSON:    true,
+			Value:   `["/bin/app", "--debug"]`,
+			Line:    14,
+		},
+	}
+
+	// run test
+	got, err := parseDockerfile(data)
+	if err != nil {
+		t.Errorf("parseDockerfile returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got.Instructions, want) {
+		for i, inst := range got.Instructions {
+			t.Logf("instruction %d: %+v", i, inst)
+		}
+
+		t.Errorf("parseDockerfile is %v, want %v", got.Instructions, want)
+	}
+}
+
+func TestImg_parseDockerfile_Escape(t *testing.T) {
+	// setup types
+	data := []byte("# escape=`\nFROM mcr.microsoft.com/windows/servercore\nRUN dir c:\\ `\n  && echo done\n")
+
+	// run test
+	got, err := parseDockerfile(data)
+	if err != nil {
+		t.Errorf("parseDockerfile returned err: %v", err)
+	}
+
+	if len(got.Instructions) != 2 {
+		t.Fatalf("parseDockerfile instructions are %d, want 2", len(got.Instructions))
+	}
+
+	want := `dir c:\  && echo done`
+
+	if got.Instructions[1].Value != want {
+		t.Errorf("parseDockerfile value is %s, want %s", got.Instructions[1].Value, want)
+	}
+}
+
+func TestImg_parseDockerfile_Failure(t *testing.T) {
+	// setup types
+	data := []byte("FROM alpine\nRUN <<EOF\necho missing terminator\n")
+
+	// run test
+	_, err := parseDockerfile(data)
+	if err == nil {
+		t.Errorf("parseDockerfile should have returned err")
+	}
+}
+
+func TestImg_dockerfile_Stages(t *testing.T) {
+	// setup types
+	d, err := parseDockerfile([]byte(`ARG VERSION=1.18
+ARG BASE
+FROM golang:${VERSION} AS Builder
+ARG IGNORED=true
+FROM builder AS test
+FROM ${BASE:-alpine:3.16}
+FROM scratch
+`))
+	if err != nil {
+		t.Errorf("parseDockerfile returned err: %v", err)
+	}
+
+	// setup tests
+	tests := []struct {
+		buildArgs []string
+		want      []*stage
+	}{
+		{
+			want: []*stage{
+				{Image: "golang:1.18", Name: "builder", Line: 3},
+				{Image: "builder", Name: "test", Line: 5, Internal: true},
+				{Image: "alpine:3.16", Line: 6},
+				{Image: "scratch", Line: 7, Internal: true},
+			},
+		},
+		{
+			buildArgs: []string{"VERSION=1.19", "BASE=debian:bullseye"},
+			want: []*stage{
+				{Image: "golang:1.19", Name: "builder", Line: 3},
+				{Image: "builder", Name: "test", Line: 5, Internal: true},
+				{Image: "debian:bullseye", Line: 6},
+				{Image: "scratch", Line: 7, Internal: true},
+			},
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := d.Stages(test.buildArgs)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Stages for %v is %v, want %v", test.buildArgs, got, test.want)
+		}
+	}
+}
+
+func TestImg_readDockerfile(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_ = afero.WriteFile(appFS, "app/Dockerfile", []byte("FROM alpine\n"), 0644)
+	_ = afero.WriteFile(appFS, "large.Dockerfile", []byte(strings.Repeat("#", maxDockerfile+1)), 0644)
+
+	// setup tests
+	tests := []struct {
+		build   *Build
+		wantErr bool
+	}{
+		{build: &Build{Directory: "app"}},
+		{build: &Build{File: "app/Dockerfile"}},
+		{build: &Build{Directory: "."}, wantErr: true},
+		{build: &Build{File: "large.Dockerfile"}, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		d, err := readDockerfile(test.build.dockerfilePath())
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("readDockerfile for %s should have returned err", test.build.dockerfilePath())
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("readDockerfile for %s returned err: %v", test.build.dockerfilePath(), err)
+		}
+
+		if len(d.Instructions) != 1 {
+			t.Errorf("readDockerfile instructions are %d, want 1", len(d.Instructions))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+// pruneAction removes the unused data from the state directory.
+const pruneAction = "prune"
+
+// lockFile is the name of the file locking the state directory.
+const lockFile = ".vela-img.lock"
+
+// lockInterval is the duration to wait before
+// retrying to lock the state directory.
+var lockInterval = time.Second
+
+// errLocked indicates the lock is held by another process.
+var errLocked = errors.New("lock is held by another process")
+
+// Img represents the img binary and the runner used to execute it.
+//
+// A nil Img uses the binary from the image with the host runner.
+type Img struct {
+	// Binary should be the path to the img binary
+	Binary string
+	// Runner should execute the commands for img
+	Runner Runner
+	// State should be the directory img stores the images and cache in
+	State string
+}
+
+// imgFlags represents for img settings on the cli.
+var imgFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "img.binary",
+		Usage:    "should be the path to the img binary",
+		EnvVars:  []string{"PARAMETER_IMG_BINARY", "IMG_BINARY"},
+		FilePath: string("/vela/parameters/img/binary,/vela/secrets/img/binary"),
+		Value:    _img,
+	},
+}
+
+// binary returns the path to the img binary.
+func (i *Img) binary() string {
+	// check if Binary is provided
+	if i == nil || len(i.Binary) == 0 {
+		return _img
+	}
+
+	return i.Binary
+}
+
+// runner returns the runner executing the commands for img.
+func (i *Img) runner() Runner {
+	// check if Runner is provided
+	if i == nil || i.Runner == nil {
+		return new(execRunner)
+	}
+
+	return i.Runner
+}
+
+// state returns the directory img stores the images and cache in.
+func (i *Img) state() string {
+	if i == nil {
+		return ""
+	}
+
+	return i.State
+}
+
+// Command creates the img command with the provided arguments.
+func (i *Img) Command(args ...string) *exec.Cmd {
+	// check if State is provided
+	if len(i.state()) > 0 {
+		// add flag for State since it applies to every img command
+		args = append([]string{fmt.Sprintf("-s=%s", i.State)}, args...)
+	}
+
+	// nolint:gosec // this functionality is not exploitable the way
+	// the plugin accepts configuration
+	return exec.Command(i.binary(), args...)
+}
+
+// Lock acquires an exclusive lock on the state directory to prevent
+// concurrent steps sharing the directory from corrupting it and
+// returns a function releasing the lock.
+//
+// The state directory is accessed with the OS filesystem
+// since the lock requires a file descriptor for the file.
+func (i *Img) Lock(ctx context.Context) (func(), error) {
+	// check if State is provided
+	if len(i.state()) == 0 {
+		return func() {}, nil
+	}
+
+	logrus.Tracef("locking img state %s", i.State)
+
+	err := os.MkdirAll(i.State, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create img state %s: %w", i.State, err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(i.State, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open img state lock: %w", err)
+	}
+
+	for waiting := false; ; waiting = true {
+		err = lock(f)
+		if err == nil {
+			break
+		}
+
+		// check if the lock is held by another process
+		if !errors.Is(err, errLocked) {
+			f.Close()
+
+			return nil, fmt.Errorf("unable to lock img state %s: %w", i.State, err)
+		}
+
+		if !waiting {
+			logrus.Infof("waiting for lock on img state %s held by another step", i.State)
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+
+			return nil, fmt.Errorf("unable to lock img state %s: %w", i.State, ctx.Err())
+		case <-time.After(lockInterval):
+		}
+	}
+
+	return func() {
+		logrus.Tracef("unlocking img state %s", i.State)
+
+		_ = unlock(f)
+
+		f.Close()
+	}, nil
+}
+
+// Run executes the provided command with the provided secrets masked
+// in the output and returns the output captured from the command.
+func (i *Img) Run(ctx context.Context, e *exec.Cmd, secrets ...string) ([]byte, error) {
+	logrus.Tracef("executing cmd %s", mask(strings.Join(e.Args, " "), secrets...))
+
+	// output "trace" string for command
+	printCmd(e, secrets...)
+
+	return i.runner().Run(ctx, e.Args[0], e.Args[1:], e.Stdin)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImg_Img_Command(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		img  *Img
+		want []string
+	}{
+		{img: nil, want: []string{_img, "version"}},
+		{img: &Img{}, want: []string{_img, "version"}},
+		{img: &Img{Binary: "/usr/local/bin/img"}, want: []string{"/usr/local/bin/img", "version"}},
+		{img: &Img{State: "/vela/cache/img"}, want: []string{_img, "-s=/vela/cache/img", "version"}},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := test.img.Command("version")
+
+		if !reflect.DeepEqual(got.Args, test.want) {
+			t.Errorf("Command args are %v, want %v", got.Args, test.want)
+		}
+	}
+}
+
+func TestImg_Img_Run(t *testing.T) {
+	// setup types
+	r := &fakeRunner{output: []byte("hello")}
+
+	i := &Img{
+		Binary: "/usr/local/bin/img",
+		Runner: r,
+	}
+
+	e := i.Command(loginAction, "--password-stdin", "index.docker.io")
+	e.Stdin = strings.NewReader("superSecretPassword")
+
+	got, err := i.Run(context.Background(), e, "superSecretPassword")
+	if err != nil {
+		t.Errorf("Run returned err: %v", err)
+	}
+
+	if string(got) != "hello" {
+		t.Errorf("Run output is %s, want hello", got)
+	}
+
+	want := [][]string{{"/usr/local/bin/img", loginAction, "--password-stdin", "index.docker.io"}}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Run calls are %v, want %v", r.calls, want)
+	}
+
+	if !reflect.DeepEqual(r.stdin, []string{"superSecretPassword"}) {
+		t.Errorf("Run stdin is %v, want %v", r.stdin, []string{"superSecretPassword"})
+	}
+}
+
+func TestImg_Img_Run_Error(t *testing.T) {
+	// setup types
+	i := &Img{
+		Runner: &fakeRunner{err: errors.New("exit status 1")},
+	}
+
+	_, err := i.Run(context.Background(), versionCmd(i))
+	if err == nil {
+		t.Errorf("Run should have returned err")
+	}
+}
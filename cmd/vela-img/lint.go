@@ -0,0 +1,395 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// lintOff skips linting the Dockerfile.
+	lintOff = "off"
+	// lintWarn logs the findings for the Dockerfile and continues the build.
+	lintWarn = "warn"
+	// lintError logs the findings for the Dockerfile and fails the build.
+	lintError = "error"
+)
+
+const (
+	// ruleMissingFrom reports a Dockerfile without a FROM instruction before the other instructions.
+	ruleMissingFrom = "missing-from"
+	// ruleUnknownInstruction reports an instruction not supported by the Dockerfile frontend.
+	ruleUnknownInstruction = "unknown-instruction"
+	// ruleMissingTarget reports a build target that is not a stage in the Dockerfile.
+	ruleMissingTarget = "missing-target"
+	// ruleUnpinnedBase reports a base image without a tag or digest.
+	ruleUnpinnedBase = "unpinned-base"
+	// ruleLatestBase reports a base image using the latest tag.
+	ruleLatestBase = "latest-base"
+	// ruleAptCleanup reports apt-get installing packages without removing the package lists.
+	ruleAptCleanup = "apt-cleanup"
+	// ruleAddURL reports ADD downloading a URL without a checksum.
+	ruleAddURL = "add-url"
+	// ruleRootUser reports an image running as the root user.
+	ruleRootUser = "root-user"
+)
+
+// lintRules are the rules checked for the Dockerfile.
+var lintRules = []string{
+	ruleMissingFrom,
+	ruleUnknownInstruction,
+	ruleMissingTarget,
+	ruleUnpinnedBase,
+	ruleLatestBase,
+	ruleAptCleanup,
+	ruleAddURL,
+	ruleRootUser,
+}
+
+// instructions are the instructions supported by the Dockerfile frontend.
+var instructions = []string{
+	"ADD", "ARG", "CMD", "COPY", "ENTRYPOINT", "ENV", "EXPOSE", "FROM", "HEALTHCHECK",
+	"LABEL", "MAINTAINER", "ONBUILD", "RUN", "SHELL", "STOPSIGNAL", "USER", "VOLUME", "WORKDIR",
+}
+
+// Lint represents the plugin configuration for linting the Dockerfile.
+type Lint struct {
+	// Mode should be the action taken for the findings (off|warn|error)
+	Mode string
+	// Ignore should be the rules skipped for the Dockerfile
+	Ignore []string
+}
+
+// lintFlags represents for lint settings on the cli.
+var lintFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "lint.mode",
+		Usage:    "should be the action taken for the findings from linting the Dockerfile - options: (off|warn|error)",
+		EnvVars:  []string{"PARAMETER_LINT_MODE", "LINT_MODE"},
+		FilePath: string("/vela/parameters/img/lint/mode,/vela/secrets/img/lint/mode"),
+		Value:    lintOff,
+	},
+	&cli.StringSliceFlag{
+		Name:     "lint.ignore",
+		Usage:    "should be the rules skipped when linting the Dockerfile (e.g. root-user)",
+		EnvVars:  []string{"PARAMETER_LINT_IGNORE", "LINT_IGNORE"},
+		FilePath: string("/vela/parameters/img/lint/ignore,/vela/secrets/img/lint/ignore"),
+	},
+}
+
+// lintFinding represents a rule the Dockerfile does not follow.
+type lintFinding struct {
+	// rule the Dockerfile does not follow
+	Rule string
+	// line the finding is for or zero for the whole file
+	Line int
+	// description of the finding
+	Message string
+}
+
+// Enabled checks if the Dockerfile should be linted.
+func (l *Lint) Enabled() bool {
+	return l != nil && len(l.Mode) > 0 && l.Mode != lintOff
+}
+
+// Exec lints the Dockerfile for the Build and returns an
+// error for the findings when the error mode is used.
+func (l *Lint) Exec(b *Build) error {
+	logrus.Trace("running lint with provided configuration")
+
+	path := b.dockerfilePath()
+
+	logrus.Infof("linting Dockerfile %s", path)
+
+	d, err := readDockerfile(path)
+	if err != nil {
+		// check if the findings should fail the build
+		if l.Mode == lintError {
+			return err
+		}
+
+		logrus.Warnf("unable to lint Dockerfile: %v", err)
+
+		return nil
+	}
+
+	// variable to store the findings that are not ignored
+	var findings []*lintFinding
+
+	for _, f := range lintDockerfile(d, b) {
+		if contains(l.Ignore, f.Rule) {
+			continue
+		}
+
+		findings = append(findings, f)
+	}
+
+	for _, f := range findings {
+		msg := fmt.Sprintf("%s:%d: %s (%s)", path, f.Line, f.Message, f.Rule)
+
+		// check if the findings should fail the build
+		if l.Mode == lintError {
+			logrus.Error(msg)
+
+			continue
+		}
+
+		logrus.Warn(msg)
+	}
+
+	if l.Mode == lintError && len(findings) > 0 {
+		return fmt.Errorf("dockerfile %s failed lint with %d findings", path, len(findings))
+	}
+
+	return nil
+}
+
+// Validate verifies the Lint is properly configured.
+func (l *Lint) Validate() error {
+	logrus.Trace("validating lint plugin configuration")
+
+	switch l.Mode {
+	case "", lintOff, lintWarn, lintError:
+	default:
+		return fmt.Errorf("invalid lint mode provided: %s", l.Mode)
+	}
+
+	// verify the ignored rules exist
+	for _, rule := range l.Ignore {
+		if !contains(lintRules, rule) {
+			return fmt.Errorf("invalid lint ignore rule provided: %s", rule)
+		}
+	}
+
+	return nil
+}
+
+// lintDockerfile returns the findings for the Dockerfile
+// built with the target and build args from the Build.
+func lintDockerfile(d *dockerfile, b *Build) []*lintFinding {
+	// variable to store the findings
+	var findings []*lintFinding
+
+	// variable to track if a FROM instruction is found
+	from := false
+
+	for _, inst := range d.Instructions {
+		switch {
+		case !contains(instructions, inst.Command):
+			findings = append(findings, &lintFinding{
+				Rule:    ruleUnknownInstruction,
+				Line:    inst.Line,
+				Message: fmt.Sprintf("unknown instruction %s", inst.Command),
+			})
+		case inst.Command == "FROM":
+			from = true
+		case !from && inst.Command != "ARG":
+			findings = append(findings, &lintFinding{
+				Rule:    ruleMissingFrom,
+				Line:    inst.Line,
+				Message: fmt.Sprintf("%s instruction found before the first FROM instruction", inst.Command),
+			})
+		case inst.Command == "RUN":
+			findings = append(findings, lintRun(inst)...)
+		case inst.Command == "ADD":
+			findings = append(findings, lintAdd(inst)...)
+		}
+	}
+
+	// check if the Dockerfile has no stages
+	if !from {
+		return append(findings, &lintFinding{
+			Rule:    ruleMissingFrom,
+			Message: "no FROM instruction found",
+		})
+	}
+
+	stages := d.Stages(b.AllBuildArgs())
+
+	for _, s := range stages {
+		findings = append(findings, lintBase(s)...)
+	}
+
+	// variable to store the index of the stage built for the image
+	final := len(stages) - 1
+
+	// check if a target is provided
+	if len(b.Target) > 0 {
+		final = -1
+
+		for i, s := range stages {
+			if s.Name == strings.ToLower(b.Target) {
+				final = i
+			}
+		}
+
+		if final < 0 {
+			return append(findings, &lintFinding{
+				Rule:    ruleMissingTarget,
+				Message: fmt.Sprintf("no stage found for build target %s", b.Target),
+			})
+		}
+	}
+
+	return append(findings, lintUser(d, stages, stages[final])...)
+}
+
+// lintBase returns the findings for the image the stage is built from.
+func lintBase(s *stage) []*lintFinding {
+	// skip the stages built from other stages or images
+	// with arguments that could not be expanded
+	if s.Internal || len(s.Image) == 0 || strings.Contains(s.Image, "$") {
+		return nil
+	}
+
+	// check if the image is pinned to a digest
+	if strings.Contains(s.Image, "@") {
+		return nil
+	}
+
+	tag := strings.TrimPrefix(strings.TrimPrefix(s.Image, imageName(s.Image)), ":")
+
+	switch tag {
+	case "":
+		return []*lintFinding{{
+			Rule:    ruleUnpinnedBase,
+			Line:    s.Line,
+			Message: fmt.Sprintf("base image %s is not pinned to a tag or digest", s.Image),
+		}}
+	case "latest":
+		return []*lintFinding{{
+			Rule:    ruleLatestBase,
+			Line:    s.Line,
+			Message: fmt.Sprintf("base image %s uses the latest tag", s.Image),
+		}}
+	default:
+		return nil
+	}
+}
+
+// lintRun returns the findings for the RUN instruction.
+func lintRun(inst *instruction) []*lintFinding {
+	// check if packages are installed with apt
+	if !strings.Contains(inst.Value, "apt-get install") && !strings.Contains(inst.Value, "apt install") {
+		return nil
+	}
+
+	// check if the package lists are removed in the same layer
+	if strings.Contains(inst.Value, "/var/lib/apt/lists") {
+		return nil
+	}
+
+	return []*lintFinding{{
+		Rule:    ruleAptCleanup,
+		Line:    inst.Line,
+		Message: "apt-get install without removing /var/lib/apt/lists",
+	}}
+}
+
+// lintAdd returns the findings for the ADD instruction.
+func lintAdd(inst *instruction) []*lintFinding {
+	// check if the download is verified with a checksum
+	if _, ok := inst.Flag("checksum"); ok {
+		return nil
+	}
+
+	// variable to store the findings
+	var findings []*lintFinding
+
+	// the last argument is the destination
+	for i := 0; i < len(inst.Args)-1; i++ {
+		src := inst.Args[i]
+
+		if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+			findings = append(findings, &lintFinding{
+				Rule:    ruleAddURL,
+				Line:    inst.Line,
+				Message: fmt.Sprintf("ADD downloads %s without a checksum", src),
+			})
+		}
+	}
+
+	return findings
+}
+
+// lintUser returns the findings for the user the stage built for the image
+// runs as including the user inherited from a previous stage.
+func lintUser(d *dockerfile, stages []*stage, s *stage) []*lintFinding {
+	// variable to store the user for the stage
+	user, line := stageUser(d, s)
+
+	// check if the user is inherited from a previous stage
+	for parent := s; len(user) == 0 && parent.Internal; {
+		// variable to store the previous stage the stage is built from
+		var previous *stage
+
+		for _, p := range stages {
+			if p.Line < parent.Line && len(p.Name) > 0 && p.Name == strings.ToLower(parent.Image) {
+				previous = p
+			}
+		}
+
+		// check if the stage is built from scratch
+		if previous == nil {
+			break
+		}
+
+		parent = previous
+
+		user, line = stageUser(d, parent)
+	}
+
+	// remove the group from the user
+	name, _, _ := strings.Cut(user, ":")
+
+	switch name {
+	case "":
+		return []*lintFinding{{
+			Rule:    ruleRootUser,
+			Line:    s.Line,
+			Message: "no USER instruction found so the image runs as root",
+		}}
+	case "root", "0":
+		return []*lintFinding{{
+			Rule:    ruleRootUser,
+			Line:    line,
+			Message: fmt.Sprintf("USER %s runs the image as root", user),
+		}}
+	default:
+		return nil
+	}
+}
+
+// stageUser returns the last user and line of the USER instruction for the stage.
+func stageUser(d *dockerfile, s *stage) (string, int) {
+	// variable to store the user for the stage
+	user, line := "", 0
+
+	// variable to track if the instructions are within the stage
+	within := false
+
+	for _, inst := range d.Instructions {
+		if inst.Command == "FROM" {
+			// stop at the next stage
+			if within {
+				break
+			}
+
+			within = inst.Line == s.Line
+
+			continue
+		}
+
+		if within && inst.Command == "USER" && len(inst.Args) > 0 {
+			user, line = inst.Args[0], inst.Line
+		}
+	}
+
+	return user, line
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestImg_lintDockerfile(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		name   string
+		file   string
+		target string
+		want   []*lintFinding
+	}{
+		{
+			name: "clean",
+			file: `ARG VERSION=3.16
+FROM golang:1.18 AS builder
+RUN apt-get update && apt-get install -y git && rm -rf /var/lib/apt/lists/*
+ADD --checksum=sha256:abc123 https://example.com/app.tar.gz /tmp/
+FROM alpine:${VERSION}
+COPY --from=builder /bin/app /bin/app
+USER nobody
+`,
+		},
+		{
+			name: "missing from",
+			file: "RUN echo hello\n",
+			want: []*lintFinding{
+				{Rule: ruleMissingFrom, Line: 1, Message: "RUN instruction found before the first FROM instruction"},
+				{Rule: ruleMissingFrom, Message: "no FROM instruction found"},
+			},
+		},
+		{
+			name: "unknown instruction",
+			file: "FROM alpine:3.16\nRUNN echo hello\nUSER 1000\n",
+			want: []*lintFinding{
+				{Rule: ruleUnknownInstruction, Line: 2, Message: "unknown instruction RUNN"},
+			},
+		},
+		{
+			name:   "missing target",
+			file:   "FROM alpine:3.16 AS build\nUSER 1000\n",
+			target: "test",
+			want: []*lintFinding{
+				{Rule: ruleMissingTarget, Message: "no stage found for build target test"},
+			},
+		},
+		{
+			name: "base images",
+			file: "FROM golang AS builder\nFROM alpine:latest\nFROM builder\nUSER 1000\n",
+			want: []*lintFinding{
+				{Rule: ruleUnpinnedBase, Line: 1, Message: "base image golang is not pinned to a tag or digest"},
+				{Rule: ruleLatestBase, Line: 2, Message: "base image alpine:latest uses the latest tag"},
+			},
+		},
+		{
+			name: "apt cleanup",
+			file: "FROM debian:bullseye\nRUN apt-get update \\\n  && apt-get install -y curl\nUSER 1000\n",
+			want: []*lintFinding{
+				{Rule: ruleAptCleanup, Line: 2, Message: "apt-get install without removing /var/lib/apt/lists"},
+			},
+		},
+		{
+			name: "add url",
+			file: "FROM alpine:3.16\nADD https://example.com/app.tar.gz /tmp/\nUSER 1000\n",
+			want: []*lintFinding{
+				{Rule: ruleAddURL, Line: 2, Message: "ADD downloads https://example.com/app.tar.gz without a checksum"},
+			},
+		},
+		{
+			name: "root user",
+			file: "FROM alpine:3.16 AS base\nUSER 1000\nFROM alpine:3.16\nUSER root:root\n",
+			want: []*lintFinding{
+				{Rule: ruleRootUser, Line: 4, Message: "USER root:root runs the image as root"},
+			},
+		},
+		{
+			name: "no user",
+			file: "FROM alpine:3.16 AS base\nUSER 1000\nFROM alpine:3.16\n",
+			want: []*lintFinding{
+				{Rule: ruleRootUser, Line: 3, Message: "no USER instruction found so the image runs as root"},
+			},
+		},
+		{
+			name: "inherited user",
+			file: "FROM alpine:3.16 AS base\nUSER 1000\nFROM base\nRUN echo hello\n",
+		},
+		{
+			name:   "target user",
+			file:   "FROM alpine:3.16 AS base\nFROM base AS test\nUSER 1000\n",
+			target: "Base",
+			want: []*lintFinding{
+				{Rule: ruleRootUser, Line: 1, Message: "no USER instruction found so the image runs as root"},
+			},
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		d, err := parseDockerfile([]byte(test.file))
+		if err != nil {
+			t.Errorf("parseDockerfile for %s returned err: %v", test.name, err)
+		}
+
+		got := lintDockerfile(d, &Build{Target: test.target})
+
+		if !reflect.DeepEqual(got, test.want) {
+			for _, f := range got {
+				t.Logf("finding for %s: %+v", test.name, f)
+			}
+
+			t.Errorf("lintDockerfile for %s is %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestImg_Lint_Exec(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_ = afero.WriteFile(appFS, "app/Dockerfile", []byte("FROM alpine:latest\n"), 0644)
+
+	// setup tests
+	tests := []struct {
+		lint    *Lint
+		build   *Build
+		wantErr bool
+	}{
+		{lint: &Lint{Mode: lintWarn}, build: &Build{Directory: "app"}},
+		{lint: &Lint{Mode: lintError}, build: &Build{Directory: "app"}, wantErr: true},
+		{lint: &Lint{Mode: lintError, Ignore: []string{ruleLatestBase, ruleRootUser}}, build: &Build{Directory: "app"}},
+		{lint: &Lint{Mode: lintWarn}, build: &Build{Directory: "."}},
+		{lint: &Lint{Mode: lintError}, build: &Build{Directory: "."}, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := test.lint.Exec(test.build)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Exec for %s should have returned err", test.lint.Mode)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Exec for %s returned err: %v", test.lint.Mode, err)
+		}
+	}
+}
+
+func TestImg_Lint_Enabled(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		lint *Lint
+		want bool
+	}{
+		{lint: nil, want: false},
+		{lint: &Lint{}, want: false},
+		{lint: &Lint{Mode: lintOff}, want: false},
+		{lint: &Lint{Mode: lintWarn}, want: true},
+		{lint: &Lint{Mode: lintError}, want: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := test.lint.Enabled()
+
+		if got != test.want {
+			t.Errorf("Enabled for %v is %v, want %v", test.lint, got, test.want)
+		}
+	}
+}
+
+func TestImg_Lint_Validate(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		lint    *Lint
+		wantErr bool
+	}{
+		{lint: &Lint{Mode: lintOff}},
+		{lint: &Lint{Mode: lintWarn, Ignore: []string{ruleRootUser, ruleAptCleanup}}},
+		{lint: &Lint{Mode: "foo"}, wantErr: true},
+		{lint: &Lint{Mode: lintError, Ignore: []string{"foo"}}, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := test.lint.Validate()
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Validate for %v should have returned err", test.lint)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Validate for %v returned err: %v", test.lint, err)
+		}
+	}
+}
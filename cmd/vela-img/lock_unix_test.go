@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestImg_Img_Lock(t *testing.T) {
+	// setup types
+	i := &Img{State: t.TempDir()}
+
+	interval := lockInterval
+	lockInterval = 10 * time.Millisecond
+
+	defer func() { lockInterval = interval }()
+
+	unlock, err := i.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("Lock returned err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = i.Lock(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Lock returned err %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	unlock()
+
+	unlock, err = i.Lock(context.Background())
+	if err != nil {
+		t.Errorf("Lock returned err: %v", err)
+	}
+
+	unlock()
+}
+
+func TestImg_Img_Lock_NoState(t *testing.T) {
+	// setup types
+	var i *Img
+
+	unlock, err := i.Lock(context.Background())
+	if err != nil {
+		t.Errorf("Lock returned err: %v", err)
+	}
+
+	unlock()
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// lock is a no-op since img does not run on Windows.
+func lock(f *os.File) error {
+	logrus.Warn("locking img state is not supported on windows")
+
+	return nil
+}
+
+// unlock is a no-op since img does not run on Windows.
+func unlock(f *os.File) error {
+	return nil
+}
@@ -7,6 +7,8 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -46,6 +48,12 @@ func main() {
 			Usage:    "set log level - options: (trace|debug|info|warn|error|fatal|panic)",
 			Value:    "info",
 		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_DRY_RUN", "IMG_DRY_RUN"},
+			FilePath: string("/vela/parameters/img/dry_run,/vela/secrets/img/dry_run"),
+			Name:     "dry-run",
+			Usage:    "validate the configuration and print the commands without executing them",
+		},
 	}
 
 	// add config flags
@@ -54,6 +62,24 @@ func main() {
 	// add build flags
 	app.Flags = append(app.Flags, buildFlags...)
 
+	// add push flags
+	app.Flags = append(app.Flags, pushFlags...)
+
+	// add metadata flags
+	app.Flags = append(app.Flags, metadataFlags...)
+
+	// add img flags
+	app.Flags = append(app.Flags, imgFlags...)
+
+	// add retry flags
+	app.Flags = append(app.Flags, retryFlags...)
+
+	// add sign flags
+	app.Flags = append(app.Flags, signFlags...)
+
+	// add lint flags
+	app.Flags = append(app.Flags, lintFlags...)
+
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Fatal(err)
@@ -88,34 +114,84 @@ func run(c *cli.Context) error {
 		"registry": "https://hub.docker.com/r/target/vela-img",
 	}).Info("Vela Img Plugin")
 
+	// load the additional registries
+	registries, err := loadRegistries(c.String("config.registries"))
+	if err != nil {
+		return err
+	}
+
+	// load the build configuration
+	b, err := loadBuild(c)
+	if err != nil {
+		return err
+	}
+
+	// load the build matrix
+	builds, err := loadBuilds(c, b)
+	if err != nil {
+		return err
+	}
+
+	// create the img binary shared by the plugin
+	img := &Img{
+		Binary: c.String("img.binary"),
+		Runner: new(execRunner),
+		State:  c.String("build.state"),
+	}
+
+	for _, b := range builds {
+		b.Img = img
+	}
+
 	// create the plugin
 	p := Plugin{
 		Config: &Config{
-			Password: c.String("config.password"),
-			URL:      c.String("config.registry"),
-			Username: c.String("config.username"),
+			Img:          img,
+			Insecure:     c.StringSlice("config.insecure_registries"),
+			LoginMode:    c.String("config.login_mode"),
+			Password:     c.String("config.password"),
+			Path:         c.String("config.path"),
+			Registries:   registries,
+			RequireLogin: c.Bool("config.require_login"),
+			URL:          c.String("config.registry"),
+			Username:     c.String("config.username"),
+		},
+		Builds:       builds,
+		DryRun:       c.Bool("dry-run"),
+		Img:          img,
+		MetadataFile: c.String("build.metadata_file"),
+		Parallel:     c.Int("build.parallel"),
+		Prune:        c.Bool("build.prune"),
+		Push: &Push{
+			DryRun:   c.Bool("push.dry-run"),
+			Img:      img,
+			Insecure: c.StringSlice("config.insecure_registries"),
 		},
-		Build: &Build{
-			BuildArgs: c.StringSlice("build.build-args"),
-			CacheFrom: c.StringSlice("build.cache-from"),
-			Directory: c.String("build.directory"),
-			File:      c.String("build.file"),
-			Labels:    c.StringSlice("build.labels"),
-			NoCache:   c.Bool("build.no-cache"),
-			NoConsole: c.Bool("build.no-console"),
-			Output:    c.String("build.output"),
-			Platforms: c.StringSlice("build.platforms"),
-			Tags:      c.StringSlice("build.tags"),
-			Target:    c.String("build.target"),
+		Lint: &Lint{
+			Ignore: c.StringSlice("lint.ignore"),
+			Mode:   c.String("lint.mode"),
 		},
+		Retry: &Retry{
+			Attempts: c.Int("retry.attempts"),
+			Backoff:  c.Duration("retry.backoff"),
+		},
+		Sign: &Sign{
+			Key:      c.String("sign.key"),
+			Password: c.String("sign.password"),
+		},
+		Timeout: c.Duration("build.timeout"),
 	}
 
 	// validate the plugin
-	err := p.Validate()
+	err = p.Validate()
 	if err != nil {
 		return err
 	}
 
+	// cancel the plugin when the step is stopped
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// execute the plugin
-	return p.Exec()
+	return p.Exec(ctx)
 }
@@ -0,0 +1,280 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-vela/types/constants"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	// semver matches a semantic version with an optional "v" prefix.
+	semver = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+	// invalidTag matches characters that are not allowed in an image tag.
+	invalidTag = regexp.MustCompile(`[^a-z0-9_.-]+`)
+)
+
+// Metadata represents the Vela build information for the plugin.
+type Metadata struct {
+	// Author should be the author of the build
+	Author string
+	// Branch should be the branch for the build
+	Branch string
+	// BuildLink should be the link to the build
+	BuildLink string
+	// Clone should be the url for cloning the repo
+	Clone string
+	// Commit should be the commit SHA for the build
+	Commit string
+	// Created should be the unix timestamp the build was created
+	Created string
+	// DefaultBranch should be the default branch for the repo
+	DefaultBranch string
+	// Event should be the event for the build
+	Event string
+	// Link should be the link to the repo
+	Link string
+	// Number should be the number for the build
+	Number string
+	// Ref should be the reference for the build
+	Ref string
+	// Repo should be the full name of the repo
+	Repo string
+	// Server should be the address of the Vela server
+	Server string
+	// Tag should be the tag for the build
+	Tag string
+}
+
+// metadataFlags represents for Vela build settings on the cli.
+var metadataFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "metadata.author",
+		Usage:   "should be the author of the build",
+		EnvVars: []string{"VELA_BUILD_AUTHOR"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.branch",
+		Usage:   "should be the branch for the build",
+		EnvVars: []string{"VELA_BUILD_BRANCH"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.build-link",
+		Usage:   "should be the link to the build",
+		EnvVars: []string{"VELA_BUILD_LINK"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.clone",
+		Usage:   "should be the url for cloning the repo",
+		EnvVars: []string{"VELA_REPO_CLONE"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.commit",
+		Usage:   "should be the commit SHA for the build",
+		EnvVars: []string{"VELA_BUILD_COMMIT"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.created",
+		Usage:   "should be the unix timestamp the build was created",
+		EnvVars: []string{"VELA_BUILD_CREATED"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.default-branch",
+		Usage:   "should be the default branch for the repo",
+		EnvVars: []string{"VELA_REPO_BRANCH"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.event",
+		Usage:   "should be the event for the build",
+		EnvVars: []string{"VELA_BUILD_EVENT"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.link",
+		Usage:   "should be the link to the repo",
+		EnvVars: []string{"VELA_REPO_LINK"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.number",
+		Usage:   "should be the number for the build",
+		EnvVars: []string{"VELA_BUILD_NUMBER"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.ref",
+		Usage:   "should be the reference for the build",
+		EnvVars: []string{"VELA_BUILD_REF"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.repo",
+		Usage:   "should be the full name of the repo",
+		EnvVars: []string{"VELA_REPO_FULL_NAME"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.server",
+		Usage:   "should be the address of the Vela server",
+		EnvVars: []string{"VELA_ADDR"},
+	},
+	&cli.StringFlag{
+		Name:    "metadata.tag",
+		Usage:   "should be the tag for the build",
+		EnvVars: []string{"VELA_BUILD_TAG"},
+	},
+}
+
+// Tags creates the list of image tags for the
+// repo from the Vela build information.
+func (m *Metadata) Tags(repo string) []string {
+	logrus.Trace("creating automatic tags from build information")
+
+	// variable to store tags for the image
+	var tags []string
+
+	// check if the build is for a tag
+	if len(m.Tag) > 0 {
+		tags = append(tags, versionTags(m.Tag)...)
+	}
+
+	// check if the build is a push to a branch
+	if strings.EqualFold(m.Event, constants.EventPush) && len(m.Branch) > 0 {
+		// check if the branch is the default branch
+		if m.Branch == m.DefaultBranch {
+			tags = append(tags, "latest")
+		}
+
+		tags = append(tags, slug(m.Branch))
+	}
+
+	// check if the commit is provided
+	if len(m.Commit) > 0 {
+		tags = append(tags, shortSHA(m.Commit))
+	}
+
+	// variable to store unique references for the image
+	var references []string
+
+	// variable to track tags already added
+	seen := make(map[string]bool)
+
+	for _, tag := range tags {
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+
+		references = append(references, fmt.Sprintf("%s:%s", repo, tag))
+	}
+
+	return references
+}
+
+// Labels creates the list of OCI image labels
+// from the Vela build information.
+//
+// https://github.com/opencontainers/image-spec/blob/main/annotations.md
+func (m *Metadata) Labels() []string {
+	logrus.Trace("creating automatic labels from build information")
+
+	// variable to store labels for the image
+	var labels []string
+
+	// check if the author is provided
+	if len(m.Author) > 0 {
+		labels = append(labels, fmt.Sprintf("org.opencontainers.image.authors=%s", m.Author))
+	}
+
+	// check if the created timestamp is provided
+	if len(m.Created) > 0 {
+		labels = append(labels, fmt.Sprintf("org.opencontainers.image.created=%s", created(m.Created)))
+	}
+
+	// check if the commit is provided
+	if len(m.Commit) > 0 {
+		labels = append(labels, fmt.Sprintf("org.opencontainers.image.revision=%s", m.Commit))
+	}
+
+	// check if the link is provided
+	if len(m.Link) > 0 {
+		labels = append(labels, fmt.Sprintf("org.opencontainers.image.source=%s", m.Link))
+		labels = append(labels, fmt.Sprintf("org.opencontainers.image.url=%s", m.Link))
+	}
+
+	// check if the tag is provided
+	if len(m.Tag) > 0 {
+		labels = append(labels, fmt.Sprintf("org.opencontainers.image.version=%s", m.Tag))
+	}
+
+	// check if the build number is provided
+	if len(m.Number) > 0 {
+		labels = append(labels, fmt.Sprintf("io.vela.build.number=%s", m.Number))
+	}
+
+	return labels
+}
+
+// created converts the unix timestamp to the RFC 3339
+// format or returns the value if it is not a timestamp.
+func created(value string) string {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
+
+// versionTags creates the list of tags for a Git tag. Semantic versions
+// are expanded to the major, minor and patch versions unless they are
+// a pre-release, otherwise the slug of the Git tag is used.
+func versionTags(tag string) []string {
+	match := semver.FindStringSubmatch(tag)
+	if match == nil {
+		return []string{slug(tag)}
+	}
+
+	version := fmt.Sprintf("%s.%s.%s", match[1], match[2], match[3])
+
+	// check if the version is a pre-release
+	if len(match[4]) > 0 {
+		return []string{version + match[4]}
+	}
+
+	return []string{
+		match[1],
+		fmt.Sprintf("%s.%s", match[1], match[2]),
+		version,
+	}
+}
+
+// shortSHA returns the abbreviated form of the commit SHA.
+func shortSHA(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+
+	return commit
+}
+
+// slug converts the value to a valid image tag.
+func slug(value string) string {
+	s := invalidTag.ReplaceAllString(strings.ToLower(value), "-")
+
+	// tags may not start with a period or dash
+	s = strings.TrimLeft(s, ".-")
+
+	// tags may contain a maximum of 128 characters
+	if len(s) > 128 {
+		s = s[:128]
+	}
+
+	return s
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImg_Metadata_Tags(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		name     string
+		metadata *Metadata
+		want     []string
+	}{
+		{
+			name: "push to default branch",
+			metadata: &Metadata{
+				Branch:        "main",
+				Commit:        "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+				DefaultBranch: "main",
+				Event:         "push",
+			},
+			want: []string{
+				"target/vela-img:latest",
+				"target/vela-img:main",
+				"target/vela-img:7bd468e",
+			},
+		},
+		{
+			name: "push to feature branch",
+			metadata: &Metadata{
+				Branch:        "Feature/Add_Push",
+				Commit:        "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+				DefaultBranch: "main",
+				Event:         "push",
+			},
+			want: []string{
+				"target/vela-img:feature-add_push",
+				"target/vela-img:7bd468e",
+			},
+		},
+		{
+			name: "pull request",
+			metadata: &Metadata{
+				Branch:        "main",
+				Commit:        "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+				DefaultBranch: "main",
+				Event:         "pull_request",
+			},
+			want: []string{
+				"target/vela-img:7bd468e",
+			},
+		},
+		{
+			name: "semantic version tag",
+			metadata: &Metadata{
+				Branch:        "main",
+				Commit:        "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+				DefaultBranch: "main",
+				Event:         "tag",
+				Tag:           "v1.2.3",
+			},
+			want: []string{
+				"target/vela-img:1",
+				"target/vela-img:1.2",
+				"target/vela-img:1.2.3",
+				"target/vela-img:7bd468e",
+			},
+		},
+		{
+			name: "pre-release tag",
+			metadata: &Metadata{
+				Commit: "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+				Event:  "tag",
+				Tag:    "v1.2.3-rc.1",
+			},
+			want: []string{
+				"target/vela-img:1.2.3-rc.1",
+				"target/vela-img:7bd468e",
+			},
+		},
+		{
+			name: "non semantic version tag",
+			metadata: &Metadata{
+				Event: "tag",
+				Tag:   "Release/2022",
+			},
+			want: []string{
+				"target/vela-img:release-2022",
+			},
+		},
+		{
+			name:     "no build information",
+			metadata: &Metadata{},
+			want:     nil,
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.metadata.Tags("target/vela-img")
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Tags is %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestImg_slug(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "main", want: "main"},
+		{value: "feature/Foo Bar", want: "feature-foo-bar"},
+		{value: "-.hidden", want: "hidden"},
+		{value: "release_1.2", want: "release_1.2"},
+		{value: strings.Repeat("a", 200), want: strings.Repeat("a", 128)},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := slug(test.value)
+
+		if got != test.want {
+			t.Errorf("slug is %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestImg_Metadata_Labels(t *testing.T) {
+	// setup types
+	m := &Metadata{
+		Author:  "octocat",
+		Commit:  "7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+		Created: "1663016400",
+		Link:    "https://github.com/go-vela/vela-img",
+		Number:  "42",
+		Tag:     "v1.2.3",
+	}
+
+	want := []string{
+		"org.opencontainers.image.authors=octocat",
+		"org.opencontainers.image.created=2022-09-12T21:00:00Z",
+		"org.opencontainers.image.revision=7bd468e0a8ec8b1b6fc2bc5ab4ad1c1fd3a9b1e1",
+		"org.opencontainers.image.source=https://github.com/go-vela/vela-img",
+		"org.opencontainers.image.url=https://github.com/go-vela/vela-img",
+		"org.opencontainers.image.version=v1.2.3",
+		"io.vela.build.number=42",
+	}
+
+	got := m.Labels()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Labels is %v, want %v", got, want)
+	}
+}
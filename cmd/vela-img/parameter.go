@@ -0,0 +1,279 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// keyValues represents a list of values in the 'key=value' format
+// that can be provided as either a list or a map in the parameter.
+type keyValues []string
+
+// UnmarshalJSON parses the list or map into the list of values.
+func (k *keyValues) UnmarshalJSON(data []byte) error {
+	// variable to store the values as a list
+	var list []string
+
+	err := json.Unmarshal(data, &list)
+	if err == nil {
+		*k = list
+
+		return nil
+	}
+
+	// variable to store the values as a map
+	values := make(map[string]interface{})
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err = decoder.Decode(&values)
+	if err != nil {
+		return fmt.Errorf("expected a list or map of values: %w", err)
+	}
+
+	// variable to store the values in the 'key=value' format
+	list = make([]string, 0, len(values))
+
+	for key, value := range values {
+		// check if the number was converted from YAML which
+		// drops the formatting for decimals (e.g. 1.10 to 1.1)
+		if n, ok := value.(json.Number); ok && strings.ContainsAny(n.String(), ".eE") {
+			return fmt.Errorf("value %s for %s must be quoted to keep the formatting", n, key)
+		}
+
+		s, err := scalarValue(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+
+		list = append(list, fmt.Sprintf("%s=%s", key, s))
+	}
+
+	sort.Strings(list)
+
+	*k = list
+
+	return nil
+}
+
+// scalarValue formats the string, number, boolean or null value
+// decoded from JSON with numbers as a string.
+func scalarValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("expected a string, number, boolean or null value")
+	}
+}
+
+// UnmarshalJSON parses the structured parameter into the Build
+// and returns an error for any unknown fields in the parameter.
+func (b *Build) UnmarshalJSON(data []byte) error {
+	// alias the type to avoid recursively calling this function
+	type build Build
+
+	parameter := &struct {
+		*build
+
+		BuildArgs keyValues `json:"build_args"`
+		Labels    keyValues `json:"labels"`
+		Secrets   keyValues `json:"secrets"`
+	}{
+		build: (*build)(b),
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(parameter)
+	if err != nil {
+		return err
+	}
+
+	// check if BuildArgs is provided
+	if parameter.BuildArgs != nil {
+		b.BuildArgs = parameter.BuildArgs
+	}
+
+	// check if Labels is provided
+	if parameter.Labels != nil {
+		b.Labels = parameter.Labels
+	}
+
+	// check if Secrets is provided
+	if parameter.Secrets != nil {
+		b.Secrets = parameter.Secrets
+	}
+
+	return nil
+}
+
+// parseBuild unmarshals the JSON or YAML input into the Build.
+func parseBuild(input string, b *Build) error {
+	logrus.Trace("parsing structured build parameter")
+
+	// convert the input to JSON since YAML is a superset of JSON
+	data, err := yaml.YAMLToJSON([]byte(input))
+	if err != nil {
+		return fmt.Errorf("unable to parse build parameter: %w", err)
+	}
+
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return fmt.Errorf("unable to parse build parameter: %w", err)
+	}
+
+	return nil
+}
+
+// loadBuild creates the Build from the structured parameter
+// merged with the individual parameters. Individual parameters
+// that are provided take precedence over the structured parameter.
+func loadBuild(c *cli.Context) (*Build, error) {
+	logrus.Trace("loading build information")
+
+	b := new(Build)
+
+	// check if the structured parameter is provided
+	if input := c.String("build.config"); len(strings.TrimSpace(input)) > 0 {
+		err := parseBuild(input, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	setBool(c, "build.auto_cache", &b.AutoCache)
+	setBool(c, "build.auto_labels", &b.AutoLabels)
+	setBool(c, "build.auto_tag", &b.AutoTag)
+	setString(c, "build.backend", &b.Backend)
+	setSlice(c, "build.build-args", &b.BuildArgs)
+	setString(c, "build.build_args_file", &b.BuildArgsFile)
+	setSlice(c, "build.cache-from", &b.CacheFrom)
+	setSlice(c, "build.cache_to", &b.CacheTo)
+	setString(c, "build.directory", &b.Directory)
+	setString(c, "build.file", &b.File)
+	setSlice(c, "build.labels", &b.Labels)
+	setBool(c, "build.no-cache", &b.NoCache)
+	setBool(c, "build.no-console", &b.NoConsole)
+	setString(c, "build.output", &b.Output)
+	setSlice(c, "build.platforms", &b.Platforms)
+	setString(c, "build.provenance", &b.Provenance)
+	setString(c, "build.provenance_file", &b.ProvenanceFile)
+	setString(c, "build.repo", &b.Repo)
+	setString(c, "build.sbom", &b.SBOM)
+	setString(c, "build.sbom_file", &b.SBOMFile)
+	setSlice(c, "build.secrets", &b.Secrets)
+	setString(c, "build.ssh", &b.SSH)
+	setSlice(c, "build.tags", &b.Tags)
+	setString(c, "build.target", &b.Target)
+
+	b.Metadata = &Metadata{
+		Author:        c.String("metadata.author"),
+		Branch:        c.String("metadata.branch"),
+		BuildLink:     c.String("metadata.build-link"),
+		Clone:         c.String("metadata.clone"),
+		Commit:        c.String("metadata.commit"),
+		Created:       c.String("metadata.created"),
+		DefaultBranch: c.String("metadata.default-branch"),
+		Event:         c.String("metadata.event"),
+		Link:          c.String("metadata.link"),
+		Number:        c.String("metadata.number"),
+		Ref:           c.String("metadata.ref"),
+		Repo:          c.String("metadata.repo"),
+		Server:        c.String("metadata.server"),
+		Tag:           c.String("metadata.tag"),
+	}
+
+	return b, nil
+}
+
+// loadBuilds creates the list of builds from the structured parameter
+// with each build using the provided Build as the base configuration.
+func loadBuilds(c *cli.Context, base *Build) ([]*Build, error) {
+	logrus.Trace("loading matrix build information")
+
+	input := c.String("build.matrix")
+
+	// check if the structured parameter is provided
+	if len(strings.TrimSpace(input)) == 0 {
+		return []*Build{base}, nil
+	}
+
+	// convert the input to JSON since YAML is a superset of JSON
+	data, err := yaml.YAMLToJSON([]byte(input))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse build matrix: %w", err)
+	}
+
+	// variable to store the configuration for each build
+	var matrix []json.RawMessage
+
+	err = json.Unmarshal(data, &matrix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse build matrix: %w", err)
+	}
+
+	// variable to store the builds
+	builds := make([]*Build, 0, len(matrix))
+
+	for i, raw := range matrix {
+		// copy the base configuration for the build
+		b := *base
+
+		// the tags are not inherited since each build
+		// must publish the image to separate references
+		b.Tags = nil
+
+		err = json.Unmarshal(raw, &b)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse build %d in matrix: %w", i, err)
+		}
+
+		builds = append(builds, &b)
+	}
+
+	return builds, nil
+}
+
+// setBool overrides the value when the parameter is provided.
+func setBool(c *cli.Context, name string, value *bool) {
+	if c.IsSet(name) {
+		*value = c.Bool(name)
+	}
+}
+
+// setSlice overrides the value when the parameter is
+// provided or uses the default when no value exists.
+func setSlice(c *cli.Context, name string, value *[]string) {
+	if c.IsSet(name) || len(*value) == 0 {
+		*value = c.StringSlice(name)
+	}
+}
+
+// setString overrides the value when the parameter is
+// provided or uses the default when no value exists.
+func setString(c *cli.Context, name string, value *string) {
+	if c.IsSet(name) || len(*value) == 0 {
+		*value = c.String(name)
+	}
+}
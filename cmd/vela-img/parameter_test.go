@@ -0,0 +1,256 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestImg_parseBuild(t *testing.T) {
+	// setup types
+	input := `
+directory: app
+file: app/Dockerfile
+build_args:
+  VERSION: 1.2.3
+  DEBUG: false
+labels:
+  - team=vela
+secrets:
+  token: GITHUB_TOKEN
+tags:
+  - target/vela-img:latest
+no_cache: true
+`
+
+	want := &Build{
+		BuildArgs: []string{"DEBUG=false", "VERSION=1.2.3"},
+		Directory: "app",
+		File:      "app/Dockerfile",
+		Labels:    []string{"team=vela"},
+		NoCache:   true,
+		Secrets:   []string{"token=GITHUB_TOKEN"},
+		Tags:      []string{"target/vela-img:latest"},
+	}
+
+	got := new(Build)
+
+	err := parseBuild(input, got)
+	if err != nil {
+		t.Errorf("parseBuild returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBuild is %+v, want %+v", got, want)
+	}
+}
+
+func TestImg_parseBuild_JSON(t *testing.T) {
+	// setup types
+	input := `{"directory": ".", "platforms": ["linux/amd64", "linux/arm64"]}`
+
+	want := &Build{
+		Directory: ".",
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+	}
+
+	got := new(Build)
+
+	err := parseBuild(input, got)
+	if err != nil {
+		t.Errorf("parseBuild returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBuild is %+v, want %+v", got, want)
+	}
+}
+
+func TestImg_parseBuild_Error(t *testing.T) {
+	// setup tests
+	tests := []string{
+		`{"directory": ".", "tag": "target/vela-img:latest"}`,
+		`labels: 1`,
+		`{"directory":`,
+	}
+
+	// run tests
+	for _, input := range tests {
+		err := parseBuild(input, new(Build))
+		if err == nil {
+			t.Errorf("parseBuild should have returned err for %s", input)
+		}
+	}
+}
+
+func TestImg_keyValues_UnmarshalJSON(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "list", input: "build_args:\n  - FOO=bar", want: []string{"FOO=bar"}},
+		{name: "string", input: "build_args:\n  VERSION: \"1.10\"", want: []string{"VERSION=1.10"}},
+		{name: "integer", input: "build_args:\n  BUILD: 12345678", want: []string{"BUILD=12345678"}},
+		{name: "json integer", input: `{"build_args": {"BUILD": 12345678}}`, want: []string{"BUILD=12345678"}},
+		{name: "boolean", input: "build_args:\n  DEBUG: true\n  VERBOSE: false", want: []string{"DEBUG=true", "VERBOSE=false"}},
+		{name: "null", input: "build_args:\n  EMPTY:", want: []string{"EMPTY="}},
+		{name: "json null", input: `{"build_args": {"EMPTY": null}}`, want: []string{"EMPTY="}},
+		{name: "decimal", input: "build_args:\n  VERSION: 1.10", wantErr: true},
+		{name: "object", input: "build_args:\n  FOO:\n    bar: baz", wantErr: true},
+		{name: "list value", input: "build_args:\n  FOO:\n    - bar", wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := new(Build)
+
+		err := parseBuild(test.input, got)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseBuild for %s should have returned err", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseBuild for %s returned err: %v", test.name, err)
+		}
+
+		if !reflect.DeepEqual(got.BuildArgs, test.want) {
+			t.Errorf("parseBuild for %s build args are %v, want %v", test.name, got.BuildArgs, test.want)
+		}
+	}
+}
+
+func TestImg_loadBuild(t *testing.T) {
+	// setup types
+	var got *Build
+
+	app := cli.NewApp()
+	app.Flags = buildFlags
+	app.Action = func(c *cli.Context) error {
+		var err error
+
+		got, err = loadBuild(c)
+
+		return err
+	}
+
+	err := app.Run([]string{
+		"vela-img",
+		`--build.config={"file": "app/Dockerfile", "tags": ["target/vela-img:config"], "no_cache": true}`,
+		"--build.tags=target/vela-img:flag",
+	})
+	if err != nil {
+		t.Errorf("loadBuild returned err: %v", err)
+	}
+
+	if got.Directory != "." {
+		t.Errorf("loadBuild directory is %s, want %s", got.Directory, ".")
+	}
+
+	if got.File != "app/Dockerfile" {
+		t.Errorf("loadBuild file is %s, want %s", got.File, "app/Dockerfile")
+	}
+
+	if !got.NoCache {
+		t.Errorf("loadBuild no cache is %v, want %v", got.NoCache, true)
+	}
+
+	if !reflect.DeepEqual(got.Tags, []string{"target/vela-img:flag"}) {
+		t.Errorf("loadBuild tags is %v, want %v", got.Tags, []string{"target/vela-img:flag"})
+	}
+}
+
+func TestImg_loadBuilds(t *testing.T) {
+	// setup types
+	var got []*Build
+
+	app := cli.NewApp()
+	app.Flags = buildFlags
+	app.Action = func(c *cli.Context) error {
+		b, err := loadBuild(c)
+		if err != nil {
+			return err
+		}
+
+		got, err = loadBuilds(c, b)
+
+		return err
+	}
+
+	err := app.Run([]string{
+		"vela-img",
+		"--build.no-cache",
+		`--build.matrix=[{"directory": "api", "tags": ["target/api:latest"]}, {"directory": "web", "target": "prod", "tags": ["target/web:latest"]}]`,
+	})
+	if err != nil {
+		t.Errorf("loadBuilds returned err: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("loadBuilds returned %d builds, want 2", len(got))
+	}
+
+	if got[0].Directory != "api" || got[1].Directory != "web" {
+		t.Errorf("loadBuilds directories are %s and %s", got[0].Directory, got[1].Directory)
+	}
+
+	if got[0].Target != "" || got[1].Target != "prod" {
+		t.Errorf("loadBuilds targets are %s and %s", got[0].Target, got[1].Target)
+	}
+
+	if !got[0].NoCache || !got[1].NoCache {
+		t.Errorf("loadBuilds should inherit no cache from the base configuration")
+	}
+}
+
+func TestImg_loadBuilds_Tags(t *testing.T) {
+	// setup types
+	var got []*Build
+
+	app := cli.NewApp()
+	app.Flags = buildFlags
+	app.Action = func(c *cli.Context) error {
+		b, err := loadBuild(c)
+		if err != nil {
+			return err
+		}
+
+		got, err = loadBuilds(c, b)
+
+		return err
+	}
+
+	err := app.Run([]string{
+		"vela-img",
+		"--build.tags=target/vela-img:latest",
+		`--build.matrix=[{"directory": "api", "tags": ["target/api:latest"]}, {"directory": "web"}]`,
+	})
+	if err != nil {
+		t.Errorf("loadBuilds returned err: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("loadBuilds returned %d builds, want 2", len(got))
+	}
+
+	if !reflect.DeepEqual(got[0].Tags, []string{"target/api:latest"}) {
+		t.Errorf("loadBuilds tags are %v, want target/api:latest", got[0].Tags)
+	}
+
+	// the tags from the base configuration are not inherited
+	if len(got[1].Tags) > 0 {
+		t.Errorf("loadBuilds tags are %v, want none", got[1].Tags)
+	}
+}
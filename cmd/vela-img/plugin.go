@@ -5,51 +5,575 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
 	"github.com/sirupsen/logrus"
 )
 
 // Plugin represents the configuration loaded for the plugin.
 type Plugin struct {
 	// build arguments loaded for the plugin
-	Build *Build
+	Builds []*Build
 	// config arguments loaded for the plugin
 	Config *Config
+	// print the commands without executing them
+	DryRun bool
+	// img binary running the commands for the plugin
+	Img *Img
+	// path to write the JSON file describing the images
+	MetadataFile string
+	// maximum number of builds executed at the same time
+	Parallel int
+	// remove the unused data from the img state after the builds
+	Prune bool
+	// push arguments loaded for the plugin
+	Push *Push
+	// retry arguments loaded for the plugin
+	Retry *Retry
+	// lint arguments loaded for the plugin
+	Lint *Lint
+	// sign arguments loaded for the plugin
+	Sign *Sign
+	// maximum duration for building and publishing the images
+	Timeout time.Duration
+}
+
+// result represents the outcome of executing a build for the plugin.
+type result struct {
+	// build that was executed
+	build *Build
+	// duration of the build
+	duration time.Duration
+	// error returned from the build
+	err error
 }
 
 // Exec formats and runs the commands for building and publishing a Docker image.
-func (p *Plugin) Exec() error {
+func (p *Plugin) Exec(ctx context.Context) error {
 	logrus.Debug("running plugin with provided configuration")
 
-	// output img version for troubleshooting
-	err := execCmd(versionCmd())
+	// check if the commands should only be printed
+	if p.DryRun {
+		return p.Print()
+	}
+
+	// check if a timeout is provided
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	// lock the img state shared with other steps
+	unlock, err := p.Img.Lock(ctx)
 	if err != nil {
 		return err
 	}
 
+	defer unlock()
+
+	// output backend versions for troubleshooting
+	for _, cmd := range p.versions() {
+		_, err := p.Img.Run(ctx, cmd)
+		if err != nil {
+			return stopped(ctx, "version", err)
+		}
+	}
+
 	// write the config.json file with Docker credentials
-	err = p.Config.Login()
+	err = p.Retry.Do(ctx, "login", func() error {
+		return p.Config.Login(ctx)
+	})
 	if err != nil {
-		return err
+		return stopped(ctx, "login", err)
+	}
+
+	// variable to store the results for each build
+	results := make([]*result, len(p.Builds))
+
+	// variable to limit the number of builds executed at the same time
+	limit := make(chan struct{}, p.parallel())
+
+	var wg sync.WaitGroup
+
+	for i, b := range p.Builds {
+		wg.Add(1)
+
+		limit <- struct{}{}
+
+		go func(i int, b *Build) {
+			defer wg.Done()
+			defer func() { <-limit }()
+
+			start := time.Now()
+
+			err := p.exec(ctx, b)
+
+			results[i] = &result{
+				build:    b,
+				duration: time.Since(start).Round(time.Second),
+				err:      err,
+			}
+		}(i, b)
+	}
+
+	wg.Wait()
+
+	// check if the img state should be pruned
+	if p.Prune {
+		p.prune(ctx)
+	}
+
+	// output the images for downstream steps
+	err = p.report(results)
+
+	// check if any build failed since it takes precedence
+	if failed := summarize(results); failed != nil {
+		return failed
+	}
+
+	return err
+}
+
+// exec runs the commands for building and publishing a single image.
+func (p *Plugin) exec(ctx context.Context, b *Build) error {
+	// publish the image with the build for backends that support it
+	b.publish = p.pushing(b)
+	b.insecure = p.insecure(b)
+
+	// check if the Dockerfile should be linted
+	if p.Lint.Enabled() {
+		// execute lint action
+		err := p.Lint.Exec(b)
+		if err != nil {
+			return err
+		}
 	}
 
 	// execute build action
-	return p.Build.Exec()
+	err := p.Retry.Do(ctx, "build", func() error {
+		return b.Exec(ctx)
+	})
+	if err != nil {
+		return stopped(ctx, "build", err)
+	}
+
+	// check if a build output is provided
+	if len(b.Output) > 0 {
+		logrus.Info("build output provided - skipping push of image")
+
+		return nil
+	}
+
+	// check if the image is published by a separate command
+	if !b.backend().Publishes() {
+		// execute push action
+		err = p.Retry.Do(ctx, "push", func() error {
+			return p.Push.Exec(ctx, b.AllTags())
+		})
+		if err != nil {
+			return stopped(ctx, "push", err)
+		}
+	}
+
+	// track the image was published since later actions may fail
+	b.pushed = p.pushing(b)
+
+	// check if the pushed image should be signed
+	if p.Sign.Enabled() && p.pushing(b) {
+		// execute sign action
+		err = p.Retry.Do(ctx, "sign", func() error {
+			return p.Sign.Exec(ctx, p.Config, b)
+		})
+		if err != nil {
+			return stopped(ctx, "sign", err)
+		}
+	}
+
+	// check if the provenance should be created for the image
+	if len(b.Provenance) == 0 {
+		return nil
+	}
+
+	// execute provenance action
+	err = p.Retry.Do(ctx, "provenance", func() error {
+		return p.provenance(ctx, b)
+	})
+	if err != nil {
+		return stopped(ctx, "provenance", err)
+	}
+
+	return nil
+}
+
+// report writes the metadata file and Vela step
+// outputs describing the images from the builds.
+func (p *Plugin) report(results []*result) error {
+	report := p.newReport(results)
+
+	// check if a metadata file is provided
+	if len(p.MetadataFile) > 0 {
+		err := report.Write(p.MetadataFile)
+		if err != nil {
+			return fmt.Errorf("unable to write metadata file: %w", err)
+		}
+	}
+
+	err := report.WriteOutputs()
+	if err != nil {
+		return fmt.Errorf("unable to write step outputs: %w", err)
+	}
+
+	return nil
+}
+
+// prune removes the unused data from the img state. Failures
+// are logged since the images were already built and published.
+func (p *Plugin) prune(ctx context.Context) {
+	_, err := p.Img.Run(ctx, p.Img.Command(pruneAction))
+	if err != nil {
+		logrus.Warnf("unable to prune img state: %v", err)
+	}
+}
+
+// stopped logs the stage that was running when the context
+// ended and returns the error with the reason it ended.
+func stopped(ctx context.Context, stage string, err error) error {
+	// check if the context has ended
+	if ctx.Err() == nil {
+		return err
+	}
+
+	// check if the context ended from the timeout
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logrus.Errorf("timed out during %s stage", stage)
+
+		return fmt.Errorf("%s timed out: %w", stage, err)
+	}
+
+	logrus.Errorf("canceled during %s stage", stage)
+
+	return fmt.Errorf("%s canceled: %w", stage, err)
+}
+
+// Print outputs the commands for building and publishing
+// the images without executing them.
+func (p *Plugin) Print() error {
+	logrus.Info("dry run enabled - printing commands without executing them")
+
+	// output backend version commands
+	for _, cmd := range p.versions() {
+		printCmd(cmd)
+	}
+
+	// output login commands
+	p.Config.Print()
+
+	for _, b := range p.Builds {
+		// publish the image with the build for backends that support it
+		b.publish = p.pushing(b)
+		b.insecure = p.insecure(b)
+
+		// check if the Dockerfile should be linted
+		if p.Lint.Enabled() {
+			err := p.Lint.Exec(b)
+			if err != nil {
+				return err
+			}
+		}
+
+		// prepare placeholders for the resources of the build
+		masks, err := b.preview()
+		if err != nil {
+			b.cleanup()
+
+			return err
+		}
+
+		// output build command
+		printCmd(b.Command(), masks...)
+
+		b.cleanup()
+
+		// check if the provenance should be written for the image
+		if b.Provenance == provenanceFile {
+			logrus.Infof("provenance for image %s would be written to %s", b.Name(), b.provenanceFile())
+		}
+
+		// check if the image is published
+		if !p.pushing(b) {
+			continue
+		}
+
+		// check if the image is published by a separate command
+		if !b.backend().Publishes() {
+			// output push commands
+			for _, tag := range b.AllTags() {
+				printCmd(p.Push.Command(tag))
+			}
+		}
+
+		// check if the pushed image should be signed
+		if p.Sign.Enabled() {
+			p.Sign.Print(b)
+		}
+
+		// check if the provenance should be attached to the pushed image
+		if b.Provenance == provenanceAttach {
+			for _, ref := range b.references() {
+				logrus.Infof("provenance would be attached to image %s", ref)
+			}
+		}
+	}
+
+	// check if the img state should be pruned
+	if p.Prune {
+		// output prune command
+		printCmd(p.Img.Command(pruneAction))
+	}
+
+	return nil
+}
+
+// versions returns the commands outputting the
+// version of each backend used by the builds.
+func (p *Plugin) versions() []*exec.Cmd {
+	// variable to store the backends used by the builds
+	var backends []string
+
+	// variable to store the version commands
+	var cmds []*exec.Cmd
+
+	for _, b := range p.Builds {
+		be := b.backend()
+
+		// check if the version is already output for the backend
+		if contains(backends, be.Name()) {
+			continue
+		}
+
+		backends = append(backends, be.Name())
+		cmds = append(cmds, be.Version(p.Img))
+	}
+
+	return cmds
+}
+
+// parallel returns the maximum number of builds executed at the same time.
+func (p *Plugin) parallel() int {
+	if p.Parallel < 1 {
+		return 1
+	}
+
+	return p.Parallel
+}
+
+// pushing checks if the Plugin publishes the image to the registry.
+//
+// img does not store the image when a build output
+// is provided so there is nothing to publish.
+func (p *Plugin) pushing(b *Build) bool {
+	return !p.Push.DryRun && len(b.Output) == 0
+}
+
+// insecure checks if any tag for the Build is published
+// to a registry communicated with over http.
+func (p *Plugin) insecure(b *Build) bool {
+	for _, tag := range b.AllTags() {
+		if insecureRegistry(p.Config.Insecure, parseReference(tag).host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// summarize outputs the results for each build and
+// returns an error if any of the builds failed.
+func summarize(results []*result) error {
+	// check if only a single build was executed
+	if len(results) == 1 {
+		return results[0].err
+	}
+
+	// variable to store the number of failed builds
+	failed := 0
+
+	fmt.Println("build summary:")
+
+	for _, r := range results {
+		status := "succeeded"
+
+		if r.err != nil {
+			failed++
+
+			status = fmt.Sprintf("failed: %v", r.err)
+		}
+
+		fmt.Printf("  %s (%s) %s\n", r.build.Name(), r.duration, status)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d builds failed", failed, len(results))
+	}
+
+	return nil
 }
 
 // Validate verifies the Plugin is properly configured.
 func (p *Plugin) Validate() error {
 	logrus.Debug("validating plugin configuration")
 
+	// check if a login mode is not provided
+	if len(p.Config.LoginMode) == 0 {
+		p.Config.LoginMode = loginExec
+
+		for _, b := range p.Builds {
+			// the other backends do not include img login so
+			// the credentials are written to the config.json file
+			if be := b.backend(); be.Name() != backendImg {
+				logrus.Infof("%s: using config login_mode %s for the %s backend", b.Name(), loginFile, be.Name())
+
+				p.Config.LoginMode = loginFile
+
+				break
+			}
+		}
+	}
+
 	// validate config configuration
 	err := p.Config.Validate()
 	if err != nil {
 		return err
 	}
 
-	// validate build configuration
-	err = p.Build.Validate()
-	if err != nil {
-		return err
+	// verify builds are provided
+	if len(p.Builds) == 0 {
+		return fmt.Errorf("no builds provided")
+	}
+
+	// variable to track if any image is published
+	pushing := false
+
+	// variable to store the builds writing each software bill of materials
+	sboms := make(map[string]string)
+
+	// variable to store the builds writing each provenance
+	provenances := make(map[string]string)
+
+	// variable to store the builds publishing each tag
+	tags := make(map[string]string)
+
+	for _, b := range p.Builds {
+		// validate build configuration
+		err = b.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.Name(), err)
+		}
+
+		// check if SBOM is provided
+		if len(b.SBOM) > 0 {
+			// verify the builds do not overwrite each software bill of materials
+			if name, ok := sboms[b.sbomFile()]; ok {
+				return fmt.Errorf("%s: build sbom_file %s is already written by %s", b.Name(), b.sbomFile(), name)
+			}
+
+			sboms[b.sbomFile()] = b.Name()
+		}
+
+		// verify the builds do not publish the same tags
+		for _, tag := range b.AllTags() {
+			if name, ok := tags[normalizeImage(tag)]; ok {
+				return fmt.Errorf("%s: build tag %s is already published by %s", b.Name(), tag, name)
+			}
+
+			tags[normalizeImage(tag)] = b.Name()
+		}
+
+		// check if the provenance is written to the workspace
+		if b.Provenance == provenanceFile {
+			// verify the builds do not overwrite each provenance
+			if name, ok := provenances[b.provenanceFile()]; ok {
+				return fmt.Errorf("%s: build provenance_file %s is already written by %s", b.Name(), b.provenanceFile(), name)
+			}
+
+			provenances[b.provenanceFile()] = b.Name()
+		}
+
+		// check if the image is published
+		if !p.pushing(b) {
+			continue
+		}
+
+		pushing = true
+
+		// validate push configuration
+		err = p.Push.Validate(b.AllTags())
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.Name(), err)
+		}
+	}
+
+	// verify credentials are provided for publishing the image
+	if pushing && !p.Config.Authenticated() {
+		return fmt.Errorf("no config credentials provided for pushing the image")
+	}
+
+	// check if the Dockerfile should be linted
+	if p.Lint != nil {
+		// validate lint configuration
+		err = p.Lint.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	// check if the pushed images should be signed
+	if p.Sign.Enabled() {
+		// validate sign configuration
+		err = p.Sign.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	// check if the img state is used
+	if len(p.Img.state()) > 0 || p.Prune {
+		for _, b := range p.Builds {
+			// verify the img backend is used since the
+			// other backends do not store their state with img
+			if be := b.backend(); be.Name() != backendImg {
+				return fmt.Errorf("%s: build state and prune are not supported by the %s backend", b.Name(), be.Name())
+			}
+		}
+	}
+
+	// check if the builds are executed at the same time
+	if p.parallel() > 1 {
+		for _, b := range p.Builds {
+			// verify the img backend is not used since the
+			// builds would share the same img state and lock
+			if be := b.backend(); be.Name() == backendImg {
+				return fmt.Errorf("%s: parallel builds are not supported by the %s backend", b.Name(), be.Name())
+			}
+		}
+	}
+
+	// check if img login is used to authenticate with the registries
+	if p.Config.execLogin() {
+		for _, b := range p.Builds {
+			// verify the img backend is used since the
+			// other backends do not include img login
+			if be := b.backend(); be.Name() != backendImg {
+				return fmt.Errorf("%s: config login_mode %s is not supported by the %s backend", b.Name(), loginExec, be.Name())
+			}
+		}
 	}
 
 	return nil
@@ -5,17 +5,329 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/spf13/afero"
 )
 
 func TestImg_Plugin_Exec(t *testing.T) {
-	// TODO Write test
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	r := new(fakeRunner)
+	i := &Img{Runner: r}
+
+	p := &Plugin{
+		Builds: []*Build{{
+			Directory: ".",
+			Img:       i,
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config: &Config{
+			Img:      i,
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Img:  i,
+		Push: &Push{Img: i},
+	}
+
+	err := p.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	want := [][]string{
+		{_img, "version"},
+		{_img, loginAction, "--password-stdin", "-u=octocat", "index.docker.io"},
+		{_img, buildAction, "-t=index.docker.io/target/vela-img:latest", "."},
+		{_img, listAction},
+		{_img, pushAction, "index.docker.io/target/vela-img:latest"},
+	}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Exec calls are %v, want %v", r.calls, want)
+	}
+}
+
+func TestImg_Plugin_Exec_Sign(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	registry := newTestRegistry(t)
+
+	key, _ := testSigningKey(t, "superSecretPassword")
+
+	tag := registry.host() + "/target/vela-img:latest"
+
+	r := &fakeRunner{
+		output: []byte(fmt.Sprintf("NAME    SIZE    CREATED AT    UPDATED AT    DIGEST\n%s    3.2MiB    now    now    sha256:abc123\n", tag)),
+	}
+	i := &Img{Runner: r}
+
+	p := &Plugin{
+		Builds: []*Build{{
+			Directory: ".",
+			Img:       i,
+			Tags:      []string{tag},
+		}},
+		Config: registry.config(),
+		Img:    i,
+		Push:   &Push{Img: i},
+		Sign: &Sign{
+			Key:      key,
+			Password: "superSecretPassword",
+		},
+	}
+
+	p.Config.Img = i
+
+	err := p.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if registry.manifest("target/vela-img", "sha256-abc123.sig") == nil {
+		t.Errorf("Exec should have signed the pushed image")
+	}
+
+	// the image is not signed when it is not pushed
+	p.Push.DryRun = true
+
+	delete(registry.manifests, "target/vela-img:sha256-abc123.sig")
+
+	err = p.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if registry.manifest("target/vela-img", "sha256-abc123.sig") != nil {
+		t.Errorf("Exec should not have signed the image")
+	}
+}
+
+func TestImg_Plugin_Exec_Lint(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_ = afero.WriteFile(appFS, "Dockerfile", []byte("FROM alpine\nRUNN echo hello\n"), 0644)
+
+	// setup types
+	r := new(fakeRunner)
+	i := &Img{Runner: r}
+
+	p := &Plugin{
+		Builds: []*Build{{
+			Directory: ".",
+			Img:       i,
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config: &Config{
+			Img:      i,
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Img:  i,
+		Lint: &Lint{Mode: lintError},
+		Push: &Push{Img: i},
+	}
+
+	err := p.Exec(context.Background())
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+
+	// the image is not built when the Dockerfile fails lint
+	for _, call := range r.calls {
+		if len(call) > 1 && call[1] == buildAction {
+			t.Errorf("Exec should not have built the image: %v", r.calls)
+		}
+	}
+}
+
+func TestImg_Plugin_Exec_Backend(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// restore the config directory modified by the file login
+	t.Setenv("DOCKER_CONFIG", "")
+
+	// setup types
+	r := new(fakeRunner)
+	i := &Img{Runner: r}
+
+	p := &Plugin{
+		Builds: []*Build{{
+			Backend:   backendBuildctl,
+			Directory: ".",
+			Img:       i,
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config: &Config{
+			Img:      i,
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Img:  i,
+		Push: &Push{Img: i},
+	}
+
+	err := p.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+
+	err = p.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// the credentials are written to the config.json file since
+	// the buildctl backend does not include img login
+	if p.Config.LoginMode != loginFile {
+		t.Errorf("Validate login mode is %s, want %s", p.Config.LoginMode, loginFile)
+	}
+
+	want := [][]string{
+		{_buildctl, "--version"},
+		{
+			_buildctlDaemonless, "build",
+			"--frontend=dockerfile.v0",
+			"--local=context=.",
+			"--local=dockerfile=.",
+			`--output=type=image,"name=index.docker.io/target/vela-img:latest",push=true`,
+		},
+	}
+
+	// remove the temporary digest file from the build command
+	if len(r.calls) == 2 && strings.HasPrefix(r.calls[1][len(r.calls[1])-1], "--metadata-file=") {
+		r.calls[1] = r.calls[1][:len(r.calls[1])-1]
+	}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Exec calls are %v, want %v", r.calls, want)
+	}
+}
+
+func TestImg_Plugin_Validate_BackendLogin(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Builds: []*Build{{
+			Backend:   backendBuildctl,
+			Directory: ".",
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config: &Config{
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Push: &Push{},
+	}
+
+	err := p.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+
+	if p.Config.LoginMode != loginFile {
+		t.Errorf("Validate login mode is %s, want %s", p.Config.LoginMode, loginFile)
+	}
+
+	// img login is not supported by the other backends
+	p.Config.LoginMode = loginExec
+
+	err = p.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Plugin_Print(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	t.Setenv("TOKEN", "superSecretToken")
+
+	// setup types
+	p := &Plugin{
+		Builds: []*Build{{
+			Directory: ".",
+			Secrets:   []string{"token=TOKEN"},
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config: &Config{
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		DryRun: true,
+		Push:   &Push{},
+	}
+
+	// capture the output of the commands
+	stdout := os.Stdout
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to create pipe: %v", err)
+	}
+
+	os.Stdout = w
+
+	err = p.Exec(context.Background())
+
+	w.Close()
+	os.Stdout = stdout
+
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unable to read output: %v", err)
+	}
+
+	for _, want := range []string{
+		"$ /usr/bin/img version",
+		"$ /usr/bin/img login --password-stdin -u=octocat index.docker.io",
+		"$ /usr/bin/img build --secret=id=token,src=<env:TOKEN>",
+		"$ /usr/bin/img push index.docker.io/target/vela-img:latest",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("Exec output is missing %q: %s", want, got)
+		}
+	}
+
+	if strings.Contains(string(got), "superSecret") {
+		t.Errorf("Exec output contains a secret: %s", got)
+	}
+
+	// verify the temporary secret file was removed
+	files, _ := afero.ReadDir(appFS, os.TempDir())
+	if len(files) > 0 {
+		t.Errorf("Exec did not remove %d temporary files", len(files))
+	}
 }
 
 func TestImg_Plugin_Validate(t *testing.T) {
 	// setup types
 	p := &Plugin{
-		Build: &Build{
+		Builds: []*Build{{
 			BuildArgs: []string{"FOO"},
 			CacheFrom: []string{"index.docker.io/target/vela-img"},
 			Directory: ".",
@@ -27,16 +339,440 @@ func TestImg_Plugin_Validate(t *testing.T) {
 			Platforms: []string{"linux/amd64"},
 			Tags:      []string{"latest"},
 			Target:    "foo",
+		}},
+		Config: &Config{
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Push: &Push{},
+	}
+
+	err := p.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Plugin_Validate_NoCredentials(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		push    *Push
+		output  string
+		wantErr bool
+	}{
+		{push: &Push{}, output: "", wantErr: true},
+		{push: &Push{DryRun: true}, output: "", wantErr: false},
+		{push: &Push{}, output: "type=tar,dest=build.tar", wantErr: false},
+	}
+
+	// run tests
+	for _, test := range tests {
+		p := &Plugin{
+			Builds: []*Build{{
+				Directory: ".",
+				Output:    test.output,
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+			}},
+			Config: &Config{
+				URL: "index.docker.io",
+			},
+			Push: test.push,
+		}
+
+		err := p.Validate()
+
+		if test.wantErr && err == nil {
+			t.Errorf("Validate should have returned err")
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("Validate returned err: %v", err)
+		}
+	}
+}
+
+func TestImg_Plugin_Validate_Matrix(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Builds: []*Build{
+			{
+				Directory: "api",
+				Tags:      []string{"index.docker.io/target/api:latest"},
+			},
+			{
+				Directory: "web",
+			},
 		},
 		Config: &Config{
 			Password: "superSecretPassword",
 			URL:      "index.docker.io",
 			Username: "octocat",
 		},
+		Push: &Push{},
 	}
 
 	err := p.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Plugin_Validate_SBOMFile(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Builds: []*Build{
+			{
+				Directory: "api",
+				SBOM:      sbomSPDX,
+				Tags:      []string{"index.docker.io/target/api:latest"},
+			},
+			{
+				Directory: "web",
+				SBOM:      sbomSPDX,
+				Tags:      []string{"index.docker.io/target/web:latest"},
+			},
+		},
+		Config: &Config{
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Push: &Push{},
+	}
+
+	err := p.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+
+	// write the software bill of materials for each build to a separate file
+	p.Builds[1].SBOMFile = "web.spdx.json"
+
+	err = p.Validate()
 	if err != nil {
 		t.Errorf("Validate returned err: %v", err)
 	}
 }
+
+func TestImg_Plugin_Validate_ProvenanceFile(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Builds: []*Build{
+			{
+				Directory:  "api",
+				Provenance: provenanceFile,
+				Tags:       []string{"index.docker.io/target/api:latest"},
+			},
+			{
+				Directory:  "web",
+				Provenance: provenanceFile,
+				Tags:       []string{"index.docker.io/target/web:latest"},
+			},
+		},
+		Config: &Config{
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Push: &Push{},
+	}
+
+	err := p.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+
+	// write the provenance for each build to a separate file
+	p.Builds[1].ProvenanceFile = "web.intoto.json"
+
+	err = p.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Plugin_Validate_DuplicateTags(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Builds: []*Build{
+			{
+				Directory: "api",
+				Tags:      []string{"target/vela-img:latest"},
+			},
+			{
+				Directory: "web",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+			},
+		},
+		Config: &Config{
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Push: &Push{},
+	}
+
+	err := p.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+
+	// publish each build to a separate repository
+	p.Builds[1].Tags = []string{"index.docker.io/target/web:latest"}
+
+	err = p.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Plugin_Validate_NoBuilds(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Config: &Config{},
+		Push:   &Push{},
+	}
+
+	err := p.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Plugin_Exec_Prune(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	r := new(fakeRunner)
+	i := &Img{Runner: r, State: t.TempDir()}
+
+	p := &Plugin{
+		Builds: []*Build{{
+			Directory: ".",
+			Img:       i,
+			Output:    "type=tar,dest=build.tar",
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config: &Config{Img: i},
+		Img:    i,
+		Prune:  true,
+		Push:   &Push{Img: i},
+	}
+
+	err := p.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	state := fmt.Sprintf("-s=%s", i.State)
+
+	want := [][]string{
+		{_img, state, "version"},
+		{_img, state, buildAction, "--output=type=tar,dest=build.tar", "-t=index.docker.io/target/vela-img:latest", "."},
+		{_img, state, pruneAction},
+	}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Exec calls are %v, want %v", r.calls, want)
+	}
+}
+
+func TestImg_Plugin_Validate_State(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		backend  string
+		state    string
+		parallel int
+		wantErr  bool
+	}{
+		{backend: backendImg, state: "/vela/cache/img", wantErr: false},
+		{backend: backendBuildctl, state: "/vela/cache/img", wantErr: true},
+		{backend: backendImg, state: "/vela/cache/img", parallel: 2, wantErr: true},
+		{backend: backendImg, parallel: 2, wantErr: true},
+		{backend: backendBuildctl, parallel: 2, wantErr: false},
+	}
+
+	// run tests
+	for _, test := range tests {
+		p := &Plugin{
+			Builds: []*Build{{
+				Backend:   test.backend,
+				Directory: ".",
+				Output:    "type=tar,dest=build.tar",
+				Tags:      []string{"index.docker.io/target/vela-img:latest"},
+			}},
+			Config:   &Config{},
+			Img:      &Img{State: test.state},
+			Parallel: test.parallel,
+			Push:     &Push{},
+		}
+
+		err := p.Validate()
+
+		if test.wantErr && err == nil {
+			t.Errorf("Validate for %s with parallel %d should have returned err", test.backend, test.parallel)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("Validate for %s with parallel %d returned err: %v", test.backend, test.parallel, err)
+		}
+	}
+}
+
+func TestImg_Plugin_Exec_Retry(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	r := &fakeRunner{
+		errs: []error{
+			nil,
+			nil,
+			nil,
+			nil,
+			&exitError{err: errors.New("exit status 1"), stderr: []byte("502 Bad Gateway")},
+		},
+	}
+	i := &Img{Runner: r}
+
+	p := &Plugin{
+		Builds: []*Build{{
+			Directory: ".",
+			Img:       i,
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config: &Config{
+			Img:      i,
+			Password: "superSecretPassword",
+			URL:      "index.docker.io",
+			Username: "octocat",
+		},
+		Img:   i,
+		Push:  &Push{Img: i},
+		Retry: &Retry{Attempts: 2},
+	}
+
+	err := p.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	push := []string{_img, pushAction, "index.docker.io/target/vela-img:latest"}
+
+	want := [][]string{
+		{_img, "version"},
+		{_img, loginAction, "--password-stdin", "-u=octocat", "index.docker.io"},
+		{_img, buildAction, "-t=index.docker.io/target/vela-img:latest", "."},
+		{_img, listAction},
+		push,
+		push,
+	}
+
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("Exec calls are %v, want %v", r.calls, want)
+	}
+}
+
+func TestImg_Plugin_Exec_Timeout(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	i := &Img{Runner: new(fakeRunner)}
+
+	p := &Plugin{
+		Builds: []*Build{{
+			Directory: ".",
+			Img:       &Img{Runner: &fakeRunner{block: true}},
+			Tags:      []string{"index.docker.io/target/vela-img:latest"},
+		}},
+		Config:  &Config{Img: i},
+		Img:     i,
+		Push:    &Push{Img: i},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+
+	err := p.Exec(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec returned err %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Exec did not stop the build after the timeout")
+	}
+}
+
+func TestImg_stopped(t *testing.T) {
+	// setup types
+	err := errors.New("exit status 1")
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	// setup tests
+	tests := []struct {
+		ctx  context.Context
+		want string
+	}{
+		{ctx: context.Background(), want: "exit status 1"},
+		{ctx: canceled, want: "build canceled: exit status 1"},
+		{ctx: expired, want: "build timed out: exit status 1"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := stopped(test.ctx, "build", err)
+
+		if got.Error() != test.want {
+			t.Errorf("stopped is %v, want %s", got, test.want)
+		}
+	}
+}
+
+func TestImg_summarize(t *testing.T) {
+	// setup types
+	api := &Build{Tags: []string{"index.docker.io/target/api:latest"}}
+	web := &Build{Tags: []string{"index.docker.io/target/web:latest"}}
+
+	err := summarize([]*result{{build: api}, {build: web}})
+	if err != nil {
+		t.Errorf("summarize returned err: %v", err)
+	}
+
+	err = summarize([]*result{{build: api}, {build: web, err: errors.New("exit status 1")}})
+	if err == nil {
+		t.Errorf("summarize should have returned err")
+	}
+}
+
+func TestImg_Plugin_insecure(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Config: &Config{Insecure: []string{"http://localhost:5000"}},
+	}
+
+	// setup tests
+	tests := []struct {
+		tags []string
+		want bool
+	}{
+		{tags: []string{"index.docker.io/target/vela-img:latest"}, want: false},
+		{tags: []string{"index.docker.io/target/vela-img:latest", "localhost:5000/target/vela-img:latest"}, want: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := p.insecure(&Build{Tags: test.tags})
+
+		if got != test.want {
+			t.Errorf("insecure for %v is %v, want %v", test.tags, got, test.want)
+		}
+	}
+}
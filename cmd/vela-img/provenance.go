@@ -0,0 +1,488 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-vela/types/constants"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+const (
+	// provenanceFile writes the provenance for the image to the workspace.
+	provenanceFile = "file"
+	// provenanceAttach uploads the provenance as a referrer for the pushed image.
+	provenanceAttach = "attach"
+)
+
+const (
+	// statementType is the type for an in-toto statement.
+	statementType = "https://in-toto.io/Statement/v1"
+	// predicateSLSA is the predicate type for SLSA provenance.
+	predicateSLSA = "https://slsa.dev/provenance/v1"
+	// provenanceBuildType is the build type describing the builds for the plugin.
+	provenanceBuildType = "https://go-vela.github.io/vela-img/provenance/v1"
+	// provenanceBuilder is the builder used when no Vela server is provided.
+	provenanceBuilder = "https://github.com/go-vela/vela-img"
+
+	// mediaInToto is the media type for an in-toto statement.
+	mediaInToto = "application/vnd.in-toto+json"
+	// mediaDSSE is the media type for a DSSE envelope.
+	mediaDSSE = "application/vnd.dsse.envelope.v1+json"
+	// mediaEmpty is the media type for the empty config of an OCI artifact.
+	mediaEmpty = "application/vnd.oci.empty.v1+json"
+)
+
+// statement represents an in-toto statement with a SLSA provenance predicate.
+//
+// https://slsa.dev/spec/v1.0/provenance
+type statement struct {
+	Type          string     `json:"_type"`
+	Subject       []resource `json:"subject"`
+	PredicateType string     `json:"predicateType"`
+	Predicate     predicate  `json:"predicate"`
+}
+
+// predicate represents the SLSA provenance predicate.
+type predicate struct {
+	BuildDefinition buildDefinition `json:"buildDefinition"`
+	RunDetails      runDetails      `json:"runDetails"`
+}
+
+// buildDefinition represents the inputs for the build in the provenance.
+type buildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	InternalParameters   map[string]interface{} `json:"internalParameters,omitempty"`
+	ResolvedDependencies []resource             `json:"resolvedDependencies,omitempty"`
+}
+
+// runDetails represents the builder and execution of the build in the provenance.
+type runDetails struct {
+	Builder  provenanceBuilderID `json:"builder"`
+	Metadata provenanceMetadata  `json:"metadata"`
+}
+
+// provenanceBuilderID represents the builder in the provenance.
+type provenanceBuilderID struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// provenanceMetadata represents the execution of the build in the provenance.
+type provenanceMetadata struct {
+	InvocationID string `json:"invocationId,omitempty"`
+	StartedOn    string `json:"startedOn,omitempty"`
+	FinishedOn   string `json:"finishedOn,omitempty"`
+}
+
+// resource represents an artifact or dependency in the provenance.
+type resource struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// provenanceFile returns the path to write the provenance to.
+func (b *Build) provenanceFile() string {
+	// check if ProvenanceFile is provided
+	if len(b.ProvenanceFile) > 0 {
+		return b.ProvenanceFile
+	}
+
+	return "provenance.intoto.json"
+}
+
+// validateProvenance verifies the provenance can be created for the image.
+func (b *Build) validateProvenance() error {
+	switch b.Provenance {
+	case "":
+		return nil
+	case provenanceFile, provenanceAttach:
+	default:
+		return fmt.Errorf("invalid build provenance provided: %s", b.Provenance)
+	}
+
+	// verify the image is stored with a digest
+	if len(b.Output) > 0 {
+		return fmt.Errorf("build provenance is not supported with build output %s", b.Output)
+	}
+
+	return nil
+}
+
+// newStatement creates the provenance for the image from the Build
+// with the digests for the base images resolved from the registries.
+func (b *Build) newStatement(ctx context.Context, c *Config) (*statement, error) {
+	// verify the digest is captured for the image
+	if len(b.digest) == 0 {
+		return nil, fmt.Errorf("no digest captured for image %s", b.Name())
+	}
+
+	s := &statement{
+		Type:          statementType,
+		PredicateType: predicateSLSA,
+	}
+
+	for _, ref := range b.references() {
+		s.Subject = append(s.Subject, resource{
+			Name:   ref.String(),
+			Digest: map[string]string{"sha256": strings.TrimPrefix(b.digest, "sha256:")},
+		})
+	}
+
+	params, err := b.parameters()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Predicate.BuildDefinition = buildDefinition{
+		BuildType:          provenanceBuildType,
+		ExternalParameters: map[string]interface{}{"build": params},
+		InternalParameters: map[string]interface{}{
+			"backend": b.backend().Name(),
+			"labels":  b.AllLabels(),
+			"tags":    b.AllTags(),
+		},
+		ResolvedDependencies: b.dependencies(ctx, c),
+	}
+
+	s.Predicate.RunDetails = runDetails{
+		Builder: provenanceBuilderID{
+			ID:      provenanceBuilder,
+			Version: map[string]string{"backend": b.backend().Name()},
+		},
+	}
+
+	// check if the start of the build is captured
+	if !b.started.IsZero() {
+		s.Predicate.RunDetails.Metadata.StartedOn = b.started.UTC().Format(time.RFC3339)
+	}
+
+	// check if the end of the build is captured
+	if !b.finished.IsZero() {
+		s.Predicate.RunDetails.Metadata.FinishedOn = b.finished.UTC().Format(time.RFC3339)
+	}
+
+	// check if the Vela build information is provided
+	if m := b.Metadata; m != nil {
+		external := s.Predicate.BuildDefinition.ExternalParameters
+		internal := s.Predicate.BuildDefinition.InternalParameters
+
+		setParameter(external, "repository", m.Repo)
+		setParameter(external, "ref", m.Ref)
+		setParameter(internal, "event", m.Event)
+		setParameter(internal, "number", m.Number)
+
+		// check if the Vela server is provided
+		if len(m.Server) > 0 {
+			s.Predicate.RunDetails.Builder.ID = m.Server
+		}
+
+		s.Predicate.RunDetails.Metadata.InvocationID = m.BuildLink
+	}
+
+	return s, nil
+}
+
+// setParameter adds the value to the parameters when it is provided.
+func setParameter(params map[string]interface{}, key, value string) {
+	if len(value) > 0 {
+		params[key] = value
+	}
+}
+
+// parameters returns the parameters provided for the Build
+// with the values derived from secrets masked.
+func (b *Build) parameters() (map[string]interface{}, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// variable to store the parameters
+	params := make(map[string]interface{})
+
+	err = json.Unmarshal(data, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	// variable to store the build args with secret values masked
+	args := []string{}
+
+	masks := b.secretBuildArgs()
+
+	for _, arg := range b.BuildArgs {
+		key, value, ok := strings.Cut(arg, "=")
+
+		if ok && len(value) > 0 && contains(masks, value) {
+			arg = fmt.Sprintf("%s=%s", key, constants.SecretMask)
+		}
+
+		args = append(args, arg)
+	}
+
+	params["build_args"] = args
+
+	// check if SSH is provided
+	if len(b.SSH) > 0 {
+		params["ssh"] = constants.SecretMask
+	}
+
+	return params, nil
+}
+
+// dependencies returns the source and base images used by the Build.
+// Failures resolving the base images are logged since the provenance
+// is still useful without them.
+func (b *Build) dependencies(ctx context.Context, c *Config) []resource {
+	// variable to store the dependencies
+	var deps []resource
+
+	// check if the commit is provided
+	if m := b.Metadata; m != nil && len(m.Commit) > 0 {
+		source := resource{Digest: map[string]string{"gitCommit": m.Commit}}
+
+		// check if the repo url is provided
+		if url := m.Clone; len(url) > 0 || len(m.Link) > 0 {
+			if len(url) == 0 {
+				url = m.Link
+			}
+
+			source.URI = fmt.Sprintf("git+%s", url)
+
+			// check if the reference is provided
+			if len(m.Ref) > 0 {
+				source.URI = fmt.Sprintf("%s@%s", source.URI, m.Ref)
+			}
+		}
+
+		deps = append(deps, source)
+	}
+
+	d, err := readDockerfile(b.dockerfilePath())
+	if err != nil {
+		logrus.Warnf("unable to resolve base images for provenance: %v", err)
+
+		return deps
+	}
+
+	// variable to store the images already resolved
+	var images []string
+
+	for _, s := range d.Stages(b.AllBuildArgs()) {
+		// skip the stages built from other stages
+		if s.Internal || len(s.Image) == 0 || contains(images, s.Image) {
+			continue
+		}
+
+		images = append(images, s.Image)
+
+		deps = append(deps, resolveImage(ctx, c, s.Image))
+	}
+
+	return deps
+}
+
+// resolveImage returns the dependency for the base image
+// with the digest resolved from the registry.
+func resolveImage(ctx context.Context, c *Config, image string) resource {
+	normalized := normalizeImage(image)
+	name := imageName(normalized)
+
+	// check if the image is pinned to a digest
+	if _, version, ok := strings.Cut(normalized, "@"); ok {
+		algorithm, digest, _ := strings.Cut(version, ":")
+
+		return resource{
+			URI:    purl("docker", "", name, version, ""),
+			Digest: map[string]string{algorithm: digest},
+		}
+	}
+
+	tag := strings.TrimPrefix(strings.TrimPrefix(normalized, name), ":")
+
+	dep := resource{
+		URI: purl("docker", "", name, tag, ""),
+	}
+
+	desc, err := newRegistryClient(c, parseReference(image)).Head(ctx, tag)
+	if err != nil {
+		logrus.Warnf("unable to resolve digest for base image %s: %v", image, err)
+
+		return dep
+	}
+
+	algorithm, digest, _ := strings.Cut(desc.Digest, ":")
+
+	dep.Digest = map[string]string{algorithm: digest}
+
+	return dep
+}
+
+// provenance creates the provenance for the image and writes
+// it to the workspace or attaches it to the pushed image.
+func (p *Plugin) provenance(ctx context.Context, b *Build) error {
+	// check if the provenance is attached to an image that was not pushed
+	if b.Provenance == provenanceAttach && !p.pushing(b) {
+		logrus.Info("image not pushed - skipping attach of provenance")
+
+		return nil
+	}
+
+	s, err := b.newStatement(ctx, p.Config)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	mediaType := mediaInToto
+
+	// check if the provenance should be signed
+	if p.Sign.Enabled() {
+		data, err = p.Sign.Envelope(mediaInToto, data)
+		if err != nil {
+			return err
+		}
+
+		mediaType = mediaDSSE
+	}
+
+	// check if the provenance should be written to the workspace
+	if b.Provenance == provenanceFile {
+		logrus.Infof("writing provenance for image %s to %s", b.Name(), b.provenanceFile())
+
+		err = writeProvenance(b.provenanceFile(), data)
+		if err != nil {
+			return err
+		}
+
+		b.attestations = []string{b.provenanceFile()}
+
+		return nil
+	}
+
+	// variable to store the referrers uploaded for the image
+	var attestations []string
+
+	for _, ref := range b.references() {
+		logrus.Infof("attaching provenance to image %s@%s", ref, b.digest)
+
+		digest, err := attachProvenance(ctx, newRegistryClient(p.Config, ref), b.digest, mediaType, data)
+		if err != nil {
+			return fmt.Errorf("unable to attach provenance to image %s: %w", ref, err)
+		}
+
+		attestations = append(attestations, fmt.Sprintf("%s@%s", ref, digest))
+	}
+
+	b.attestations = attestations
+
+	return nil
+}
+
+// writeProvenance writes the provenance to the path in the workspace.
+func writeProvenance(path string, data []byte) error {
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// check if the path includes a directory
+	if dir := filepath.Dir(path); dir != "." {
+		err := a.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// attachProvenance uploads the provenance as an OCI referrer for the
+// image and returns the digest for the referrer. The referrers tag
+// is updated for registries that do not support the referrers API.
+//
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#enabling-the-referrers-api
+func attachProvenance(ctx context.Context, r *registryClient, digest, mediaType string, data []byte) (string, error) {
+	subject, err := r.Head(ctx, digest)
+	if err != nil {
+		return "", err
+	}
+
+	layer, err := r.PutBlob(ctx, mediaType, data)
+	if err != nil {
+		return "", err
+	}
+
+	config, err := r.PutBlob(ctx, mediaEmpty, []byte("{}"))
+	if err != nil {
+		return "", err
+	}
+
+	m := &manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaManifest,
+		ArtifactType:  mediaInToto,
+		Config:        config,
+		Layers:        []descriptor{layer},
+		Subject:       &subject,
+		Annotations: map[string]string{
+			"org.opencontainers.image.created": time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	referrer := descriptor{
+		MediaType:    mediaManifest,
+		ArtifactType: mediaInToto,
+		Size:         int64(len(raw)),
+		Digest:       fmt.Sprintf("sha256:%x", sha256.Sum256(raw)),
+		Annotations:  m.Annotations,
+	}
+
+	header, err := r.put(ctx, referrer.Digest, mediaManifest, raw)
+	if err != nil {
+		return "", err
+	}
+
+	// check if the registry supports the referrers API
+	if len(header.Get("OCI-Subject")) > 0 {
+		return referrer.Digest, nil
+	}
+
+	// the referrers are stored in a tag derived from the digest
+	tag := strings.Replace(digest, ":", "-", 1)
+
+	i, err := r.Index(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+
+	if i == nil {
+		i = &index{SchemaVersion: 2, MediaType: mediaIndex}
+	}
+
+	i.Manifests = append(i.Manifests, referrer)
+
+	return referrer.Digest, r.PutIndex(ctx, tag, i)
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-vela/types/constants"
+	"github.com/spf13/afero"
+)
+
+// testImage uploads an image manifest to the registry
+// for the repository and returns the digest for it.
+func testImage(t *testing.T, registry *testRegistry, repository string) string {
+	t.Helper()
+
+	r := newRegistryClient(registry.config(), parseReference(registry.host()+"/"+repository))
+
+	m := &manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaManifest,
+		Config:        descriptor{MediaType: mediaConfig, Size: 2, Digest: "sha256:abc123"},
+	}
+
+	err := r.PutManifest(context.Background(), "latest", m)
+	if err != nil {
+		t.Fatalf("unable to upload image: %v", err)
+	}
+
+	data, _ := json.Marshal(m)
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func TestImg_Build_validateProvenance(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build   *Build
+		wantErr bool
+	}{
+		{build: &Build{}},
+		{build: &Build{Provenance: provenanceFile}},
+		{build: &Build{Provenance: provenanceAttach}},
+		{build: &Build{Provenance: "foo"}, wantErr: true},
+		{build: &Build{Provenance: provenanceFile, Output: "type=local,dest=out"}, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := test.build.validateProvenance()
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("validateProvenance for %s should have returned err", test.build.Provenance)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("validateProvenance for %s returned err: %v", test.build.Provenance, err)
+		}
+	}
+}
+
+func TestImg_Build_newStatement(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	registry := newTestRegistry(t)
+
+	base := testImage(t, registry, "library/base")
+
+	_ = afero.WriteFile(appFS, "/vela/secrets/token", []byte("superSecretToken"), 0644)
+	_ = afero.WriteFile(appFS, "Dockerfile", []byte(fmt.Sprintf(`ARG BASE=%s/library/base:latest
+FROM golang:1.18@sha256:def456 AS builder
+FROM builder AS test
+FROM ${BASE}
+`, registry.host())), 0644)
+
+	started := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	b := &Build{
+		BuildArgs: []string{"TOKEN=superSecretToken", "VERSION=1.0.0"},
+		Directory: ".",
+		Metadata: &Metadata{
+			BuildLink: "https://vela.example.com/go-vela/vela-img/1",
+			Clone:     "https://github.com/go-vela/vela-img.git",
+			Commit:    "48afb5bdc41ad69bf22588491333f7cf71135163",
+			Event:     constants.EventPush,
+			Number:    "1",
+			Ref:       "refs/heads/main",
+			Repo:      "go-vela/vela-img",
+			Server:    "https://vela.example.com",
+		},
+		SSH:      "default=/root/.ssh/id_rsa",
+		Tags:     []string{registry.host() + "/target/vela-img:latest", registry.host() + "/target/vela-img:v1"},
+		digest:   "sha256:abc123",
+		started:  started,
+		finished: started.Add(time.Minute),
+	}
+
+	// run test
+	got, err := b.newStatement(context.Background(), registry.config())
+	if err != nil {
+		t.Fatalf("newStatement returned err: %v", err)
+	}
+
+	wantSubject := []resource{{
+		Name:   registry.host() + "/target/vela-img",
+		Digest: map[string]string{"sha256": "abc123"},
+	}}
+
+	if !reflect.DeepEqual(got.Subject, wantSubject) {
+		t.Errorf("newStatement subject is %v, want %v", got.Subject, wantSubject)
+	}
+
+	wantDependencies := []resource{
+		{
+			URI:    "git+https://github.com/go-vela/vela-img.git@refs/heads/main",
+			Digest: map[string]string{"gitCommit": "48afb5bdc41ad69bf22588491333f7cf71135163"},
+		},
+		{
+			URI:    "pkg:docker/docker.io/library/golang@sha256:def456",
+			Digest: map[string]string{"sha256": "def456"},
+		},
+		{
+			URI:    fmt.Sprintf("pkg:docker/%s/library/base@latest", registry.host()),
+			Digest: map[string]string{"sha256": strings.TrimPrefix(base, "sha256:")},
+		},
+	}
+
+	if !reflect.DeepEqual(got.Predicate.BuildDefinition.ResolvedDependencies, wantDependencies) {
+		t.Errorf("newStatement dependencies are %v, want %v", got.Predicate.BuildDefinition.ResolvedDependencies, wantDependencies)
+	}
+
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Errorf("unable to marshal statement: %v", err)
+	}
+
+	// verify the secrets are masked in the parameters
+	if strings.Contains(string(data), "superSecretToken") || strings.Contains(string(data), "id_rsa") {
+		t.Errorf("newStatement should have masked the secrets: %s", data)
+	}
+
+	for _, want := range []string{
+		`"_type":"https://in-toto.io/Statement/v1"`,
+		`"predicateType":"https://slsa.dev/provenance/v1"`,
+		fmt.Sprintf(`"TOKEN=%s"`, constants.SecretMask),
+		`"VERSION=1.0.0"`,
+		`"repository":"go-vela/vela-img"`,
+		`"builder":{"id":"https://vela.example.com","version":{"backend":"img"}}`,
+		`"invocationId":"https://vela.example.com/go-vela/vela-img/1"`,
+		`"startedOn":"2022-06-01T12:00:00Z"`,
+		`"finishedOn":"2022-06-01T12:01:00Z"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("newStatement is %s, want %s", data, want)
+		}
+	}
+}
+
+func TestImg_Build_newStatement_NoDigest(t *testing.T) {
+	// setup types
+	b := &Build{
+		Tags: []string{"index.docker.io/target/vela-img:latest"},
+	}
+
+	// run test
+	_, err := b.newStatement(context.Background(), new(Config))
+	if err == nil {
+		t.Errorf("newStatement should have returned err")
+	}
+}
+
+func TestImg_Plugin_provenance_File(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_ = afero.WriteFile(appFS, "Dockerfile", []byte("FROM scratch\n"), 0644)
+
+	// setup types
+	p := &Plugin{
+		Config: new(Config),
+		Push:   &Push{DryRun: true},
+	}
+
+	b := &Build{
+		Directory:      ".",
+		Provenance:     provenanceFile,
+		ProvenanceFile: "reports/provenance.json",
+		Tags:           []string{"index.docker.io/target/vela-img:latest"},
+		digest:         "sha256:abc123",
+	}
+
+	// run test
+	err := p.provenance(context.Background(), b)
+	if err != nil {
+		t.Errorf("provenance returned err: %v", err)
+	}
+
+	data, err := afero.ReadFile(appFS, "reports/provenance.json")
+	if err != nil {
+		t.Errorf("unable to read provenance: %v", err)
+	}
+
+	s := new(statement)
+
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		t.Errorf("unable to unmarshal provenance: %v", err)
+	}
+
+	if s.PredicateType != predicateSLSA {
+		t.Errorf("provenance predicate type is %s, want %s", s.PredicateType, predicateSLSA)
+	}
+
+	if !reflect.DeepEqual(b.attestations, []string{"reports/provenance.json"}) {
+		t.Errorf("provenance attestations are %v, want reports/provenance.json", b.attestations)
+	}
+}
+
+func TestImg_Plugin_provenance_Attach(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		name      string
+		referrers bool
+	}{
+		{name: "referrers API", referrers: true},
+		{name: "referrers tag", referrers: false},
+	}
+
+	// run tests
+	for _, test := range tests {
+		// setup filesystem
+		appFS = afero.NewMemMapFs()
+
+		_ = afero.WriteFile(appFS, "Dockerfile", []byte("FROM scratch\n"), 0644)
+
+		// setup types
+		registry := newTestRegistry(t)
+		registry.referrers = test.referrers
+
+		key, _ := testSigningKey(t, "superSecretPassword")
+
+		digest := testImage(t, registry, "target/vela-img")
+
+		p := &Plugin{
+			Config: registry.config(),
+			Push:   new(Push),
+			Sign: &Sign{
+				Key:      key,
+				Password: "superSecretPassword",
+			},
+		}
+
+		b := &Build{
+			Directory:  ".",
+			Provenance: provenanceAttach,
+			Tags:       []string{registry.host() + "/target/vela-img:latest"},
+			digest:     digest,
+		}
+
+		err := p.provenance(context.Background(), b)
+		if err != nil {
+			t.Errorf("provenance for %s returned err: %v", test.name, err)
+		}
+
+		if len(b.attestations) != 1 {
+			t.Fatalf("provenance for %s attestations are %v, want 1", test.name, b.attestations)
+		}
+
+		_, referrer, _ := strings.Cut(b.attestations[0], "@")
+
+		m := registry.manifest("target/vela-img", referrer)
+		if m == nil {
+			t.Fatalf("provenance for %s should have uploaded the referrer", test.name)
+		}
+
+		if m.Subject == nil || m.Subject.Digest != digest {
+			t.Errorf("provenance for %s subject is %v, want %s", test.name, m.Subject, digest)
+		}
+
+		if len(m.Layers) != 1 || m.Layers[0].MediaType != mediaDSSE {
+			t.Errorf("provenance for %s layers are %v, want %s", test.name, m.Layers, mediaDSSE)
+		}
+
+		// check if the referrers are stored in the tag for the digest
+		tag := strings.Replace(digest, ":", "-", 1)
+
+		data, ok := registry.manifests["target/vela-img:"+tag]
+
+		if test.referrers && ok {
+			t.Errorf("provenance for %s should not have updated the referrers tag", test.name)
+		}
+
+		if !test.referrers && !strings.Contains(string(data), referrer) {
+			t.Errorf("provenance for %s referrers tag is %s, want %s", test.name, data, referrer)
+		}
+	}
+}
+
+func TestImg_Plugin_provenance_NotPushed(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Config: new(Config),
+		Push:   &Push{DryRun: true},
+	}
+
+	b := &Build{
+		Provenance: provenanceAttach,
+		Tags:       []string{"index.docker.io/target/vela-img:latest"},
+	}
+
+	// run test
+	err := p.provenance(context.Background(), b)
+	if err != nil {
+		t.Errorf("provenance returned err: %v", err)
+	}
+
+	if len(b.attestations) > 0 {
+		t.Errorf("provenance attestations are %v, want none", b.attestations)
+	}
+}
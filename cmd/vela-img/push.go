@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const pushAction = "push"
+
+// Push represents the plugin configuration for push information.
+type Push struct {
+	// DryRun should skip publishing the image to the registry
+	DryRun bool
+	// Img should be the img binary publishing the image
+	Img *Img
+	// Insecure should be the registries published to over http
+	Insecure []string
+}
+
+// pushFlags represents for push settings on the cli.
+var pushFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:     "push.dry-run",
+		Usage:    "should skip publishing the image to the registry",
+		EnvVars:  []string{"PARAMETER_NO_PUSH", "PUSH_DRY_RUN"},
+		FilePath: string("/vela/parameters/img/push/dry_run,/vela/secrets/img/push/dry_run"),
+	},
+}
+
+// Command formats and outputs the Push command from
+// the provided configuration to publish a Docker image.
+func (p *Push) Command(tag string) *exec.Cmd {
+	logrus.Trace("creating img push command from plugin configuration")
+
+	// check if the registry is communicated with over http
+	if insecureRegistry(p.Insecure, parseReference(tag).host) {
+		return p.Img.Command(pushAction, "--insecure-registry", tag)
+	}
+
+	return p.Img.Command(pushAction, tag)
+}
+
+// Exec formats and runs the commands for publishing a Docker image.
+func (p *Push) Exec(ctx context.Context, tags []string) error {
+	logrus.Trace("running push with provided configuration")
+
+	// check if the push should be skipped
+	if p.DryRun {
+		logrus.Info("dry run enabled - skipping push of image")
+
+		return nil
+	}
+
+	for _, tag := range tags {
+		// create the push command for the tag
+		cmd := p.Command(tag)
+
+		// run the push command for the tag
+		_, err := p.Img.Run(ctx, cmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate verifies the Push is properly configured.
+func (p *Push) Validate(tags []string) error {
+	logrus.Trace("validating push plugin configuration")
+
+	// check if the push should be skipped
+	if p.DryRun {
+		return nil
+	}
+
+	// verify tags are provided
+	if len(tags) == 0 {
+		return fmt.Errorf("no push tags provided")
+	}
+
+	for _, tag := range tags {
+		// verify tag is a single reference
+		if len(strings.TrimSpace(tag)) == 0 || strings.ContainsAny(tag, " \t\n") {
+			return fmt.Errorf("invalid push tag provided: %q", tag)
+		}
+	}
+
+	return nil
+}
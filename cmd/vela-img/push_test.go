@@ -0,0 +1,116 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestImg_Push_Command(t *testing.T) {
+	// setup types
+	p := &Push{}
+
+	// nolint:gosec // this functionality is not exploitable the way
+	// the plugin accepts configuration
+	want := exec.Command(
+		_img,
+		pushAction,
+		"index.docker.io/target/vela-img:latest",
+	)
+
+	got := p.Command("index.docker.io/target/vela-img:latest")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Command is %v, want %v", got, want)
+	}
+}
+
+func TestImg_Push_Command_Insecure(t *testing.T) {
+	// setup types
+	p := &Push{Insecure: []string{"http://localhost:5000"}}
+
+	// nolint:gosec // this functionality is not exploitable the way
+	// the plugin accepts configuration
+	want := exec.Command(
+		_img,
+		pushAction,
+		"--insecure-registry",
+		"localhost:5000/target/vela-img:latest",
+	)
+
+	got := p.Command("localhost:5000/target/vela-img:latest")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Command is %v, want %v", got, want)
+	}
+}
+
+func TestImg_Push_Exec_Error(t *testing.T) {
+	// setup types
+	p := &Push{
+		Img: &Img{Runner: &fakeRunner{err: errors.New("exit status 1")}},
+	}
+
+	err := p.Exec(context.Background(), []string{"index.docker.io/target/vela-img:latest"})
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+}
+
+func TestImg_Push_Exec_DryRun(t *testing.T) {
+	// setup types
+	p := &Push{
+		DryRun: true,
+	}
+
+	err := p.Exec(context.Background(), []string{"index.docker.io/target/vela-img:latest"})
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+}
+
+func TestImg_Push_Validate(t *testing.T) {
+	// setup types
+	p := &Push{}
+
+	err := p.Validate([]string{"index.docker.io/target/vela-img:latest"})
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Push_Validate_DryRun(t *testing.T) {
+	// setup types
+	p := &Push{
+		DryRun: true,
+	}
+
+	err := p.Validate(nil)
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestImg_Push_Validate_NoTags(t *testing.T) {
+	// setup types
+	p := &Push{}
+
+	err := p.Validate(nil)
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestImg_Push_Validate_InvalidTag(t *testing.T) {
+	// setup types
+	p := &Push{}
+
+	err := p.Validate([]string{"repo:a repo:b"})
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
@@ -0,0 +1,561 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// maxResponse is the maximum size of a response read from the registry.
+	maxResponse = 4 << 20
+
+	// _dockerHub is the host for the Docker Hub registry API.
+	_dockerHub = "index.docker.io"
+)
+
+// registryError represents a failed request to the Docker Registry.
+type registryError struct {
+	// method and url of the request
+	request string
+	// status code returned by the registry
+	status int
+	// body returned by the registry
+	body string
+}
+
+// Error returns the request with the status and body returned by the registry.
+func (e *registryError) Error() string {
+	return fmt.Sprintf("%s returned %d %s: %s", e.request, e.status, http.StatusText(e.status), e.body)
+}
+
+// reference represents an image in a Docker Registry.
+type reference struct {
+	// host for the registry
+	host string
+	// repository within the registry
+	repository string
+}
+
+// String returns the image name used by cosign for the reference.
+func (r *reference) String() string {
+	return fmt.Sprintf("%s/%s", r.host, r.repository)
+}
+
+// parseReference returns the registry and repository for the image.
+func parseReference(image string) *reference {
+	// variable to store the image in the 'registry/repository:tag' format
+	name := imageName(normalizeImage(image))
+
+	host, repository, _ := strings.Cut(name, "/")
+
+	// check if the image is stored in Docker Hub
+	if host == "docker.io" {
+		host = _dockerHub
+	}
+
+	return &reference{host: host, repository: repository}
+}
+
+// registryHost returns the host for the Docker Registry url
+// matching the host for the references to the registry.
+func registryHost(registry string) string {
+	// remove the scheme from the url
+	if i := strings.Index(registry, "://"); i >= 0 {
+		registry = registry[i+3:]
+	}
+
+	// remove the path from the url
+	host := strings.SplitN(registry, "/", 2)[0]
+
+	switch host {
+	case "docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return _dockerHub
+	default:
+		return host
+	}
+}
+
+// insecureRegistry checks if the host is one of
+// the registries communicated with over http.
+func insecureRegistry(registries []string, host string) bool {
+	for _, registry := range registries {
+		if registryHost(registry) == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registryClient represents a client for a repository
+// in a Docker Registry using the HTTP API V2.
+type registryClient struct {
+	// client sending the requests to the registry
+	client *http.Client
+	// scheme for the requests to the registry (http|https)
+	scheme string
+	// reference to the repository in the registry
+	ref *reference
+	// user name for communication with the registry
+	username string
+	// password for communication with the registry
+	password string
+
+	// authorization header for the requests
+	authorization string
+}
+
+// newRegistryClient creates the client for the repository with
+// the credentials provided for the registry in the Config.
+func newRegistryClient(c *Config, ref *reference) *registryClient {
+	client := c.Client
+
+	// check if a client is provided
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	username, password := c.auth(ref.host)
+
+	// variable to store the scheme for the registry
+	scheme := "https"
+
+	// check if the registry is communicated with over http
+	if insecureRegistry(c.Insecure, ref.host) {
+		scheme = "http"
+	}
+
+	return &registryClient{
+		client:   client,
+		scheme:   scheme,
+		ref:      ref,
+		username: username,
+		password: password,
+	}
+}
+
+// url returns the url to the path in the repository.
+func (r *registryClient) url(path string) string {
+	// check if the path is already a url
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		return path
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s/%s", r.scheme, r.apiHost(), r.ref.repository, path)
+}
+
+// apiHost returns the host serving the API for the registry.
+func (r *registryClient) apiHost() string {
+	// check if the registry is Docker Hub
+	if r.ref.host == _dockerHub {
+		return "registry-1.docker.io"
+	}
+
+	return r.ref.host
+}
+
+// do sends the request to the registry and authenticates
+// with the challenge returned when the request is unauthorized.
+func (r *registryClient) do(ctx context.Context, method, path string, header http.Header, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, r.url(path), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		for key, values := range header {
+			req.Header[key] = values
+		}
+
+		// check if the request should be authorized
+		if len(r.authorization) > 0 {
+			req.Header.Set("Authorization", r.authorization)
+		}
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		// check if the request was authorized
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+
+		resp.Body.Close()
+
+		err = r.authenticate(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send sends the request to the registry and returns an
+// error when the status is not one of the expected statuses.
+func (r *registryClient) send(ctx context.Context, method, path string, header http.Header, body []byte, statuses ...int) (*http.Response, []byte, error) {
+	resp, err := r.do(ctx, method, path, header, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return resp, data, nil
+		}
+	}
+
+	return nil, nil, &registryError{
+		request: fmt.Sprintf("%s %s", method, resp.Request.URL.Redacted()),
+		status:  resp.StatusCode,
+		body:    strings.TrimSpace(string(data)),
+	}
+}
+
+// authenticate sets the authorization for the requests
+// from the challenge returned by the registry.
+func (r *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		// check if the credentials are provided
+		if len(r.username) == 0 {
+			return fmt.Errorf("no credentials provided for registry %s", r.ref.host)
+		}
+
+		req := &http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(r.username, r.password)
+
+		r.authorization = req.Header.Get("Authorization")
+
+		return nil
+	case "bearer":
+		token, err := r.token(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		r.authorization = fmt.Sprintf("Bearer %s", token)
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication challenge from registry %s: %s", r.ref.host, challenge)
+	}
+}
+
+// token requests the bearer token for the repository
+// from the authorization server for the registry.
+func (r *registryClient) token(ctx context.Context, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(realm.Host) == 0 {
+		return "", fmt.Errorf("invalid authentication realm from registry %s: %s", r.ref.host, params["realm"])
+	}
+
+	query := realm.Query()
+
+	// check if the service is provided
+	if len(params["service"]) > 0 {
+		query.Set("service", params["service"])
+	}
+
+	query.Set("scope", fmt.Sprintf("repository:%s:pull,push", r.ref.repository))
+
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	// check if the credentials are provided
+	if len(r.username) > 0 {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &registryError{
+			request: fmt.Sprintf("GET %s", realm.Redacted()),
+			status:  resp.StatusCode,
+			body:    strings.TrimSpace(string(data)),
+		}
+	}
+
+	// variable to store the token returned by the server
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	err = json.Unmarshal(data, &body)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse token from registry %s: %w", r.ref.host, err)
+	}
+
+	// check if the token is provided in the OAuth2 format
+	if len(body.Token) == 0 {
+		body.Token = body.AccessToken
+	}
+
+	if len(body.Token) == 0 {
+		return "", fmt.Errorf("no token returned from registry %s", r.ref.host)
+	}
+
+	return body.Token, nil
+}
+
+// parseChallenge returns the scheme and parameters from
+// the WWW-Authenticate header returned by the registry.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, ", ")
+
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+
+		// check if the value is quoted
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				break
+			}
+
+			params[strings.ToLower(strings.TrimSpace(key))] = value[1 : end+1]
+			rest = value[end+2:]
+
+			continue
+		}
+
+		value, rest, _ = strings.Cut(value, ",")
+
+		params[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return scheme, params
+}
+
+// descriptor represents the content referenced by an OCI manifest or index.
+type descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Size         int64             `json:"size"`
+	Digest       string            `json:"digest"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// manifest represents an OCI image manifest.
+type manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Subject       *descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// index represents an OCI image index.
+type index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+const (
+	// mediaManifest is the media type for an OCI image manifest.
+	mediaManifest = "application/vnd.oci.image.manifest.v1+json"
+	// mediaIndex is the media type for an OCI image index.
+	mediaIndex = "application/vnd.oci.image.index.v1+json"
+	// mediaDockerManifest is the media type for a Docker image manifest.
+	mediaDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	// mediaDockerList is the media type for a Docker manifest list.
+	mediaDockerList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// Head returns the descriptor for the manifest referenced by the tag or digest.
+func (r *registryClient) Head(ctx context.Context, ref string) (descriptor, error) {
+	header := http.Header{"Accept": []string{mediaManifest, mediaIndex, mediaDockerManifest, mediaDockerList}}
+
+	resp, _, err := r.send(ctx, http.MethodHead, fmt.Sprintf("manifests/%s", ref), header, nil, http.StatusOK)
+	if err != nil {
+		return descriptor{}, err
+	}
+
+	d := descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Size:      resp.ContentLength,
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+	}
+
+	// verify the registry returned the digest
+	if !strings.HasPrefix(d.Digest, "sha256:") {
+		return d, fmt.Errorf("no digest returned for manifest %s from registry %s", ref, r.ref.host)
+	}
+
+	return d, nil
+}
+
+// Manifest returns the OCI manifest for the tag or nil when it does not exist.
+func (r *registryClient) Manifest(ctx context.Context, tag string) (*manifest, error) {
+	m := new(manifest)
+
+	ok, err := r.get(ctx, tag, mediaManifest, m)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Index returns the OCI index for the tag or nil when it does not exist.
+func (r *registryClient) Index(ctx context.Context, tag string) (*index, error) {
+	i := new(index)
+
+	ok, err := r.get(ctx, tag, mediaIndex, i)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// get unmarshals the manifest for the tag and returns false when it does not exist.
+func (r *registryClient) get(ctx context.Context, tag, mediaType string, v interface{}) (bool, error) {
+	header := http.Header{"Accept": []string{mediaType}}
+
+	resp, data, err := r.send(ctx, http.MethodGet, fmt.Sprintf("manifests/%s", tag), header, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+
+	// check if the manifest exists
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse manifest %s: %w", tag, err)
+	}
+
+	return true, nil
+}
+
+// PutManifest uploads the OCI manifest for the tag.
+func (r *registryClient) PutManifest(ctx context.Context, tag string, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.put(ctx, tag, m.MediaType, data)
+
+	return err
+}
+
+// PutIndex uploads the OCI index for the tag.
+func (r *registryClient) PutIndex(ctx context.Context, tag string, i *index) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.put(ctx, tag, i.MediaType, data)
+
+	return err
+}
+
+// put uploads the manifest for the tag or digest and
+// returns the headers from the response.
+func (r *registryClient) put(ctx context.Context, tag, mediaType string, data []byte) (http.Header, error) {
+	header := http.Header{"Content-Type": []string{mediaType}}
+
+	resp, _, err := r.send(ctx, http.MethodPut, fmt.Sprintf("manifests/%s", tag), header, data, http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Header, nil
+}
+
+// PutBlob uploads the contents to the repository
+// unless they exist and returns the descriptor.
+func (r *registryClient) PutBlob(ctx context.Context, mediaType string, data []byte) (descriptor, error) {
+	d := descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(data)),
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+	}
+
+	// check if the blob exists
+	resp, _, err := r.send(ctx, http.MethodHead, fmt.Sprintf("blobs/%s", d.Digest), nil, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return d, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return d, nil
+	}
+
+	// start the upload for the blob
+	resp, _, err = r.send(ctx, http.MethodPost, "blobs/uploads/", nil, nil, http.StatusAccepted)
+	if err != nil {
+		return d, err
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || len(resp.Header.Get("Location")) == 0 {
+		return d, fmt.Errorf("no upload location returned from registry %s", r.ref.host)
+	}
+
+	query := location.Query()
+	query.Set("digest", d.Digest)
+
+	location.RawQuery = query.Encode()
+
+	// finish the upload with the contents for the blob
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+
+	_, _, err = r.send(ctx, http.MethodPut, location.String(), header, data, http.StatusCreated)
+
+	return d, err
+}
@@ -0,0 +1,415 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegistry represents an in-process Docker Registry
+// requiring a bearer token for every request.
+type testRegistry struct {
+	sync.Mutex
+
+	// server handling the requests for the registry
+	server *httptest.Server
+	// credentials for requesting the token
+	username, password string
+
+	// blobs stored by digest
+	blobs map[string][]byte
+	// manifests stored by repository and tag or digest
+	manifests map[string][]byte
+	// media types for the manifests by repository and tag or digest
+	types map[string]string
+	// indicates the registry supports the referrers API
+	referrers bool
+	// number of blobs uploaded
+	uploads int
+}
+
+// newTestRegistry starts the registry which is stopped with the test.
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+
+	r := &testRegistry{
+		username:  "octocat",
+		password:  "superSecretPassword",
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+	}
+
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.handle))
+
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+// host returns the host for the registry.
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(strings.TrimPrefix(r.server.URL, "https://"), "http://")
+}
+
+// config returns the Config with the credentials for the registry.
+func (r *testRegistry) config() *Config {
+	return &Config{
+		Client:   r.server.Client(),
+		Password: r.password,
+		URL:      r.host(),
+		Username: r.username,
+	}
+}
+
+// manifest returns the manifest stored for the repository and tag.
+func (r *testRegistry) manifest(repository, tag string) *manifest {
+	r.Lock()
+	defer r.Unlock()
+
+	data, ok := r.manifests[repository+":"+tag]
+	if !ok {
+		return nil
+	}
+
+	m := new(manifest)
+
+	_ = json.Unmarshal(data, m)
+
+	return m
+}
+
+// handle serves the token and HTTP API V2 requests for the registry.
+func (r *testRegistry) handle(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	// check if a token is requested
+	if req.URL.Path == "/token" {
+		username, password, _ := req.BasicAuth()
+
+		if username != r.username || password != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"token":"secret-token"}`)
+
+		return
+	}
+
+	// check if the request is authorized
+	if req.Header.Get("Authorization") != "Bearer secret-token" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	body, _ := io.ReadAll(req.Body)
+
+	switch {
+	case strings.Contains(path, "/blobs/uploads/") && req.Method == http.MethodPost:
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s%d", path, r.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case strings.Contains(path, "/blobs/uploads/") && req.Method == http.MethodPut:
+		digest := req.URL.Query().Get("digest")
+
+		// verify the digest matches the contents
+		if digest != fmt.Sprintf("sha256:%x", sha256.Sum256(body)) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		r.blobs[digest] = body
+		r.uploads++
+
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		if _, ok := r.blobs[path[strings.LastIndex(path, "/")+1:]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case strings.Contains(path, "/manifests/"):
+		repository, tag, _ := strings.Cut(path, "/manifests/")
+
+		if req.Method == http.MethodPut {
+			digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+
+			// store the manifest by the tag and digest
+			for _, key := range []string{tag, digest} {
+				r.manifests[repository+":"+key] = body
+				r.types[repository+":"+key] = req.Header.Get("Content-Type")
+			}
+
+			// check if the manifest refers to a subject
+			if r.referrers && strings.Contains(string(body), `"subject"`) {
+				w.Header().Set("OCI-Subject", "true")
+			}
+
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+
+			return
+		}
+
+		data, ok := r.manifests[repository+":"+tag]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		mediaType := r.types[repository+":"+tag]
+		if len(mediaType) == 0 {
+			mediaType = mediaManifest
+		}
+
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(data)))
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestImg_parseReference(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "alpine", want: "index.docker.io/library/alpine"},
+		{image: "target/vela-img:latest", want: "index.docker.io/target/vela-img"},
+		{image: "index.docker.io/target/vela-img:v1", want: "index.docker.io/target/vela-img"},
+		{image: "localhost:5000/target/vela-img@sha256:abc123", want: "localhost:5000/target/vela-img"},
+		{image: "ghcr.io/go-vela/vela-img:latest", want: "ghcr.io/go-vela/vela-img"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := parseReference(test.image).String()
+
+		if got != test.want {
+			t.Errorf("parseReference for %s is %s, want %s", test.image, got, test.want)
+		}
+	}
+}
+
+func TestImg_registryHost(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		registry string
+		want     string
+	}{
+		{registry: "index.docker.io", want: _dockerHub},
+		{registry: "https://index.docker.io/v1/", want: _dockerHub},
+		{registry: "docker.io", want: _dockerHub},
+		{registry: "ghcr.io", want: "ghcr.io"},
+		{registry: "http://localhost:5000", want: "localhost:5000"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := registryHost(test.registry)
+
+		if got != test.want {
+			t.Errorf("registryHost for %s is %s, want %s", test.registry, got, test.want)
+		}
+	}
+}
+
+func TestImg_parseChallenge(t *testing.T) {
+	// setup types
+	challenge := `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:target/vela-img:pull,push"`
+
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:target/vela-img:pull,push",
+	}
+
+	// run test
+	scheme, got := parseChallenge(challenge)
+
+	if scheme != "Bearer" {
+		t.Errorf("parseChallenge scheme is %s, want Bearer", scheme)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseChallenge is %v, want %v", got, want)
+	}
+}
+
+func TestImg_registryClient_PutBlob(t *testing.T) {
+	// setup types
+	registry := newTestRegistry(t)
+
+	r := newRegistryClient(registry.config(), parseReference(registry.host()+"/target/vela-img"))
+
+	// run test
+	got, err := r.PutBlob(context.Background(), mediaSignature, []byte("hello"))
+	if err != nil {
+		t.Errorf("PutBlob returned err: %v", err)
+	}
+
+	want := descriptor{
+		MediaType: mediaSignature,
+		Size:      5,
+		Digest:    "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PutBlob is %v, want %v", got, want)
+	}
+
+	// the blob is not uploaded when it already exists
+	_, err = r.PutBlob(context.Background(), mediaSignature, []byte("hello"))
+	if err != nil {
+		t.Errorf("PutBlob returned err: %v", err)
+	}
+
+	if registry.uploads != 1 {
+		t.Errorf("PutBlob uploads are %d, want 1", registry.uploads)
+	}
+}
+
+func TestImg_registryClient_Insecure(t *testing.T) {
+	// setup types
+	registry := newTestRegistry(t)
+
+	// serve the registry over http
+	registry.server.Close()
+	registry.server = httptest.NewServer(http.HandlerFunc(registry.handle))
+
+	t.Cleanup(registry.server.Close)
+
+	c := registry.config()
+
+	ref := parseReference(registry.host() + "/target/vela-img")
+
+	// run test
+	_, err := newRegistryClient(c, ref).PutBlob(context.Background(), mediaSignature, []byte("hello"))
+	if err == nil {
+		t.Errorf("PutBlob should have returned err")
+	}
+
+	c.Insecure = []string{registry.host()}
+
+	_, err = newRegistryClient(c, ref).PutBlob(context.Background(), mediaSignature, []byte("hello"))
+	if err != nil {
+		t.Errorf("PutBlob returned err: %v", err)
+	}
+}
+
+func TestImg_registryClient_Manifest(t *testing.T) {
+	// setup types
+	registry := newTestRegistry(t)
+
+	r := newRegistryClient(registry.config(), parseReference(registry.host()+"/target/vela-img"))
+
+	want := &manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaManifest,
+		Config:        descriptor{MediaType: mediaConfig, Size: 2, Digest: "sha256:abc123"},
+		Layers:        []descriptor{{MediaType: mediaSignature, Size: 5, Digest: "sha256:def456"}},
+	}
+
+	// run test
+	got, err := r.Manifest(context.Background(), "v1")
+	if err != nil {
+		t.Errorf("Manifest returned err: %v", err)
+	}
+
+	if got != nil {
+		t.Errorf("Manifest is %v, want nil", got)
+	}
+
+	err = r.PutManifest(context.Background(), "v1", want)
+	if err != nil {
+		t.Errorf("PutManifest returned err: %v", err)
+	}
+
+	got, err = r.Manifest(context.Background(), "v1")
+	if err != nil {
+		t.Errorf("Manifest returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Manifest is %v, want %v", got, want)
+	}
+}
+
+func TestImg_registryClient_Head(t *testing.T) {
+	// setup types
+	registry := newTestRegistry(t)
+
+	r := newRegistryClient(registry.config(), parseReference(registry.host()+"/target/vela-img"))
+
+	i := &index{SchemaVersion: 2, MediaType: mediaIndex}
+
+	err := r.PutIndex(context.Background(), "v1", i)
+	if err != nil {
+		t.Errorf("PutIndex returned err: %v", err)
+	}
+
+	data, _ := json.Marshal(i)
+
+	want := descriptor{
+		MediaType: mediaIndex,
+		Size:      int64(len(data)),
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+	}
+
+	// run test
+	got, err := r.Head(context.Background(), "v1")
+	if err != nil {
+		t.Errorf("Head returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Head is %v, want %v", got, want)
+	}
+
+	// the manifest is also available by digest
+	_, err = r.Head(context.Background(), want.Digest)
+	if err != nil {
+		t.Errorf("Head returned err: %v", err)
+	}
+
+	_, err = r.Head(context.Background(), "v2")
+	if err == nil {
+		t.Errorf("Head should have returned err")
+	}
+}
+
+func TestImg_registryClient_Unauthorized(t *testing.T) {
+	// setup types
+	registry := newTestRegistry(t)
+
+	c := registry.config()
+	c.Password = "wrongPassword"
+
+	r := newRegistryClient(c, parseReference(registry.host()+"/target/vela-img"))
+
+	// run test
+	_, err := r.Manifest(context.Background(), "v1")
+	if err == nil {
+		t.Errorf("Manifest should have returned err")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// _outputs is the environment variable providing
+// the path to the file for the Vela step outputs.
+const _outputs = "VELA_OUTPUTS"
+
+// Report represents the images produced by the plugin
+// in a machine-readable format for downstream steps.
+type Report struct {
+	// images produced by the builds
+	Images []*Image `json:"images"`
+}
+
+// Image represents the image produced by a build.
+type Image struct {
+	// backend building the image
+	Backend string `json:"backend"`
+	// manifest digest for the image
+	Digest string `json:"digest,omitempty"`
+	// duration of the build
+	Duration string `json:"duration"`
+	// error returned from the build
+	Error string `json:"error,omitempty"`
+	// platforms the image was built for
+	Platforms []string `json:"platforms,omitempty"`
+	// indicates the image was published to the registry
+	Pushed bool `json:"pushed"`
+	// references to the image by digest for each repository
+	References []string `json:"references,omitempty"`
+	// references to the provenance written or attached for the image
+	Provenance []string `json:"provenance,omitempty"`
+	// repository for the image
+	Repo string `json:"repo"`
+	// path to the software bill of materials for the image
+	SBOM string `json:"sbom,omitempty"`
+	// references to the signatures uploaded for the image
+	Signatures []string `json:"signatures,omitempty"`
+	// tags for the image
+	Tags []string `json:"tags"`
+}
+
+// newReport creates the Report from the results for each build.
+func (p *Plugin) newReport(results []*result) *Report {
+	report := new(Report)
+
+	for _, r := range results {
+		b := r.build
+
+		image := &Image{
+			Backend:    b.backend().Name(),
+			Digest:     b.digest,
+			Duration:   r.duration.String(),
+			Platforms:  b.Platforms,
+			Provenance: b.attestations,
+			Pushed:     b.pushed,
+			Repo:       b.Repo,
+			Signatures: b.signatures,
+			Tags:       b.AllTags(),
+		}
+
+		// check if the build failed
+		if r.err != nil {
+			image.Error = r.err.Error()
+		}
+
+		// check if the software bill of materials was written
+		if r.err == nil && len(b.SBOM) > 0 {
+			image.SBOM = b.sbomFile()
+		}
+
+		// check if the repo should be derived from the first tag
+		if len(image.Repo) == 0 && len(image.Tags) > 0 {
+			image.Repo = imageName(image.Tags[0])
+		}
+
+		// check if the image was published with a digest
+		if image.Pushed && len(image.Digest) > 0 {
+			for _, tag := range image.Tags {
+				reference := fmt.Sprintf("%s@%s", imageName(tag), image.Digest)
+
+				if !contains(image.References, reference) {
+					image.References = append(image.References, reference)
+				}
+			}
+		}
+
+		report.Images = append(report.Images, image)
+	}
+
+	return report
+}
+
+// Write writes the Report as JSON to the provided path.
+func (r *Report) Write(path string) error {
+	logrus.Tracef("writing metadata file %s", path)
+
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// check if the path includes a directory
+	if dir := filepath.Dir(path); dir != "." {
+		err = a.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Outputs returns the Vela step outputs for the Report in the 'KEY=VALUE'
+// format. The keys for each image are prefixed with the number of the
+// build when multiple builds are executed.
+func (r *Report) Outputs() []string {
+	// variable to store the outputs
+	var outputs []string
+
+	for i, image := range r.Images {
+		prefix := "IMG_"
+
+		// check if multiple builds are executed
+		if len(r.Images) > 1 {
+			prefix = fmt.Sprintf("IMG_%d_", i+1)
+		}
+
+		outputs = append(outputs,
+			fmt.Sprintf("%sREPO=%s", prefix, image.Repo),
+			fmt.Sprintf("%sTAGS=%s", prefix, strings.Join(image.Tags, ",")),
+			fmt.Sprintf("%sDIGEST=%s", prefix, image.Digest),
+			fmt.Sprintf("%sREFERENCES=%s", prefix, strings.Join(image.References, ",")),
+		)
+	}
+
+	return outputs
+}
+
+// WriteOutputs appends the Vela step outputs for the
+// Report to the file provided by the environment.
+func (r *Report) WriteOutputs() error {
+	path := os.Getenv(_outputs)
+
+	// check if the outputs file is provided
+	if len(path) == 0 {
+		logrus.Tracef("no %s provided - skipping step outputs", _outputs)
+
+		return nil
+	}
+
+	logrus.Tracef("writing step outputs to %s", path)
+
+	f, err := appFS.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = f.WriteString(strings.Join(r.Outputs(), "\n") + "\n")
+
+	return err
+}
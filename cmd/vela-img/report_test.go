@@ -0,0 +1,214 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestImg_Plugin_newReport(t *testing.T) {
+	// setup types
+	p := &Plugin{Push: &Push{}}
+
+	results := []*result{
+		{
+			build: &Build{
+				Platforms: []string{"linux/amd64"},
+				Tags:      []string{"index.docker.io/target/vela-img:latest", "index.docker.io/target/vela-img:v1"},
+				digest:    "sha256:abc123",
+				pushed:    true,
+			},
+			duration: time.Minute,
+		},
+		{
+			build: &Build{
+				Tags:   []string{"index.docker.io/target/vela-img:signed"},
+				digest: "sha256:def456",
+				pushed: true,
+			},
+			duration: time.Minute,
+			err:      errors.New("sign failed"),
+		},
+		{
+			build: &Build{
+				Backend: backendBuildctl,
+				Repo:    "ghcr.io/target/vela-img",
+				Tags:    []string{"ghcr.io/target/vela-img:latest"},
+			},
+			duration: time.Second,
+			err:      errors.New("exit status 1"),
+		},
+	}
+
+	want := &Report{
+		Images: []*Image{
+			{
+				Backend:    backendImg,
+				Digest:     "sha256:abc123",
+				Duration:   "1m0s",
+				Platforms:  []string{"linux/amd64"},
+				Pushed:     true,
+				References: []string{"index.docker.io/target/vela-img@sha256:abc123"},
+				Repo:       "index.docker.io/target/vela-img",
+				Tags:       []string{"index.docker.io/target/vela-img:latest", "index.docker.io/target/vela-img:v1"},
+			},
+			{
+				Backend:    backendImg,
+				Digest:     "sha256:def456",
+				Duration:   "1m0s",
+				Error:      "sign failed",
+				Pushed:     true,
+				References: []string{"index.docker.io/target/vela-img@sha256:def456"},
+				Repo:       "index.docker.io/target/vela-img",
+				Tags:       []string{"index.docker.io/target/vela-img:signed"},
+			},
+			{
+				Backend:  backendBuildctl,
+				Duration: "1s",
+				Error:    "exit status 1",
+				Repo:     "ghcr.io/target/vela-img",
+				Tags:     []string{"ghcr.io/target/vela-img:latest"},
+			},
+		},
+	}
+
+	got := p.newReport(results)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newReport is %+v, want %+v", got, want)
+	}
+}
+
+func TestImg_Report_Write(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// setup types
+	r := &Report{
+		Images: []*Image{{
+			Backend: backendImg,
+			Digest:  "sha256:abc123",
+			Repo:    "index.docker.io/target/vela-img",
+			Tags:    []string{"index.docker.io/target/vela-img:latest"},
+		}},
+	}
+
+	err := r.Write("/vela/src/build/metadata.json")
+	if err != nil {
+		t.Errorf("Write returned err: %v", err)
+	}
+
+	data, err := a.ReadFile("/vela/src/build/metadata.json")
+	if err != nil {
+		t.Errorf("unable to read metadata file: %v", err)
+	}
+
+	got := new(Report)
+
+	err = json.Unmarshal(data, got)
+	if err != nil {
+		t.Errorf("unable to parse metadata file: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("metadata file is %+v, want %+v", got, r)
+	}
+}
+
+func TestImg_Report_Outputs(t *testing.T) {
+	// setup types
+	image := &Image{
+		Digest:     "sha256:abc123",
+		References: []string{"index.docker.io/target/vela-img@sha256:abc123"},
+		Repo:       "index.docker.io/target/vela-img",
+		Tags:       []string{"index.docker.io/target/vela-img:latest", "index.docker.io/target/vela-img:v1"},
+	}
+
+	// setup tests
+	tests := []struct {
+		report *Report
+		want   []string
+	}{
+		{
+			report: &Report{Images: []*Image{image}},
+			want: []string{
+				"IMG_REPO=index.docker.io/target/vela-img",
+				"IMG_TAGS=index.docker.io/target/vela-img:latest,index.docker.io/target/vela-img:v1",
+				"IMG_DIGEST=sha256:abc123",
+				"IMG_REFERENCES=index.docker.io/target/vela-img@sha256:abc123",
+			},
+		},
+		{
+			report: &Report{Images: []*Image{image, {Repo: "ghcr.io/target/vela-img"}}},
+			want: []string{
+				"IMG_1_REPO=index.docker.io/target/vela-img",
+				"IMG_1_TAGS=index.docker.io/target/vela-img:latest,index.docker.io/target/vela-img:v1",
+				"IMG_1_DIGEST=sha256:abc123",
+				"IMG_1_REFERENCES=index.docker.io/target/vela-img@sha256:abc123",
+				"IMG_2_REPO=ghcr.io/target/vela-img",
+				"IMG_2_TAGS=",
+				"IMG_2_DIGEST=",
+				"IMG_2_REFERENCES=",
+			},
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := test.report.Outputs()
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Outputs is %v, want %v", got, test.want)
+		}
+	}
+}
+
+func TestImg_Report_WriteOutputs(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	t.Setenv(_outputs, "/vela/outputs/.env")
+
+	_ = a.WriteFile("/vela/outputs/.env", []byte("FOO=bar\n"), 0644)
+
+	// setup types
+	r := &Report{
+		Images: []*Image{{
+			Digest: "sha256:abc123",
+			Repo:   "index.docker.io/target/vela-img",
+		}},
+	}
+
+	err := r.WriteOutputs()
+	if err != nil {
+		t.Errorf("WriteOutputs returned err: %v", err)
+	}
+
+	data, err := a.ReadFile("/vela/outputs/.env")
+	if err != nil {
+		t.Errorf("unable to read outputs file: %v", err)
+	}
+
+	want := "FOO=bar\n" + strings.Join(r.Outputs(), "\n") + "\n"
+
+	if string(data) != want {
+		t.Errorf("outputs file is %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+// fatalErrors are the messages from a failed program
+// indicating the failure is not resolved by retrying.
+var fatalErrors = []string{
+	"unauthorized",
+	"authentication required",
+	"incorrect username or password",
+	"access denied",
+	"denied: ",
+	"forbidden",
+	"dockerfile parse error",
+	"failed to parse dockerfile",
+	"unknown instruction",
+	"unknown flag",
+	"x509: ",
+}
+
+// retryableErrors are the messages from a failed program
+// indicating the failure may be resolved by retrying.
+var retryableErrors = []string{
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"no such host",
+	"temporary failure in name resolution",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"429 too many requests",
+	"toomanyrequests",
+}
+
+// Retry represents the plugin configuration for retry information.
+type Retry struct {
+	// Attempts should be the maximum number of attempts for each stage
+	Attempts int
+	// Backoff should be the duration to wait before the first retry
+	Backoff time.Duration
+}
+
+// retryFlags represents for retry settings on the cli.
+var retryFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:     "retry.attempts",
+		Usage:    "should be the maximum number of attempts for the login, build, push, sign and provenance stages",
+		EnvVars:  []string{"PARAMETER_RETRY_ATTEMPTS", "RETRY_ATTEMPTS"},
+		FilePath: string("/vela/parameters/img/retry/attempts,/vela/secrets/img/retry/attempts"),
+		Value:    1,
+	},
+	&cli.DurationFlag{
+		Name:     "retry.backoff",
+		Usage:    "should be the duration to wait before the first retry which doubles after each retry",
+		EnvVars:  []string{"PARAMETER_RETRY_BACKOFF", "RETRY_BACKOFF"},
+		FilePath: string("/vela/parameters/img/retry/backoff,/vela/secrets/img/retry/backoff"),
+		Value:    5 * time.Second,
+	},
+}
+
+// attempts returns the maximum number of attempts for each stage.
+func (r *Retry) attempts() int {
+	// check if Attempts is provided
+	if r == nil || r.Attempts < 1 {
+		return 1
+	}
+
+	return r.Attempts
+}
+
+// Do runs the stage until it succeeds, fails with an error
+// that is not retryable or the attempts are exhausted.
+func (r *Retry) Do(ctx context.Context, stage string, fn func() error) error {
+	// variable to store the duration to wait before retrying
+	var backoff time.Duration
+
+	if r != nil {
+		backoff = r.Backoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.attempts() || !retryable(ctx, err) {
+			return err
+		}
+
+		logrus.Warnf("%s stage failed on attempt %d of %d - retrying in %s: %v", stage, attempt, r.attempts(), backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// retryable checks if the error is from a transient failure by
+// matching the output the program wrote to stderr or the status
+// returned by the registry. Failures that are not recognized are
+// not retried to avoid repeating deterministic failures.
+func retryable(ctx context.Context, err error) bool {
+	// check if the context has ended
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// variable to store the error from the registry
+	var re *registryError
+
+	if errors.As(err, &re) {
+		return re.status == http.StatusTooManyRequests || re.status >= http.StatusInternalServerError
+	}
+
+	// variable to store the error from the connection to the registry
+	var ue *url.Error
+
+	if errors.As(err, &ue) {
+		return transient([]byte(ue.Error()))
+	}
+
+	// variable to store the error from the program
+	var e *exitError
+
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	return transient(e.stderr)
+}
+
+// transient checks if the message matches a failure that
+// may be resolved by retrying and no failure that is not.
+func transient(msg []byte) bool {
+	msg = bytes.ToLower(msg)
+
+	for _, fatal := range fatalErrors {
+		if bytes.Contains(msg, []byte(fatal)) {
+			return false
+		}
+	}
+
+	for _, retry := range retryableErrors {
+		if bytes.Contains(msg, []byte(retry)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestImg_Retry_Do(t *testing.T) {
+	// setup types
+	transient := &exitError{err: errors.New("exit status 1"), stderr: []byte("502 Bad Gateway")}
+	fatal := &exitError{err: errors.New("exit status 1"), stderr: []byte("401 Unauthorized")}
+
+	// setup tests
+	tests := []struct {
+		retry   *Retry
+		errs    []error
+		want    int
+		wantErr bool
+	}{
+		{retry: nil, errs: []error{transient}, want: 1, wantErr: true},
+		{retry: &Retry{Attempts: 3}, errs: nil, want: 1, wantErr: false},
+		{retry: &Retry{Attempts: 3}, errs: []error{transient, transient}, want: 3, wantErr: false},
+		{retry: &Retry{Attempts: 3}, errs: []error{transient, transient, transient}, want: 3, wantErr: true},
+		{retry: &Retry{Attempts: 3}, errs: []error{fatal}, want: 1, wantErr: true},
+		{retry: &Retry{Attempts: 3}, errs: []error{errors.New("exit status 1")}, want: 1, wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		// variable to store the number of attempts
+		got := 0
+
+		errs := test.errs
+
+		err := test.retry.Do(context.Background(), "push", func() error {
+			got++
+
+			if len(errs) == 0 {
+				return nil
+			}
+
+			err := errs[0]
+			errs = errs[1:]
+
+			return err
+		})
+
+		if test.wantErr && err == nil {
+			t.Errorf("Do should have returned err")
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("Do returned err: %v", err)
+		}
+
+		if got != test.want {
+			t.Errorf("Do attempts are %d, want %d", got, test.want)
+		}
+	}
+}
+
+func TestImg_Retry_Do_Canceled(t *testing.T) {
+	// setup types
+	r := &Retry{Attempts: 3}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// variable to store the number of attempts
+	got := 0
+
+	err := r.Do(ctx, "build", func() error {
+		got++
+
+		cancel()
+
+		return &exitError{err: errors.New("exit status 1"), stderr: []byte("connection reset by peer")}
+	})
+	if err == nil {
+		t.Errorf("Do should have returned err")
+	}
+
+	if got != 1 {
+		t.Errorf("Do attempts are %d, want 1", got)
+	}
+}
+
+func TestImg_retryable(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("exit status 1"), want: false},
+		{err: &exitError{err: errors.New("exit status 1"), stderr: []byte("read: connection reset by peer")}, want: true},
+		{err: &exitError{err: errors.New("exit status 1"), stderr: []byte("unexpected status: 503 Service Unavailable")}, want: true},
+		{err: &exitError{err: errors.New("exit status 1"), stderr: []byte("429 Too Many Requests")}, want: true},
+		{err: &exitError{err: errors.New("exit status 1"), stderr: []byte("net/http: TLS handshake timeout")}, want: true},
+		{err: &exitError{err: errors.New("exit status 1"), stderr: []byte("401 Unauthorized")}, want: false},
+		{err: &exitError{err: errors.New("exit status 1"), stderr: []byte("dockerfile parse error line 3: unknown instruction: FORM")}, want: false},
+		{err: &exitError{err: errors.New("exit status 1"), stderr: []byte("no space left on device")}, want: false},
+		{err: fmt.Errorf("unable to sign image: %w", &registryError{status: http.StatusBadGateway}), want: true},
+		{err: &registryError{status: http.StatusTooManyRequests}, want: true},
+		{err: &registryError{status: http.StatusForbidden}, want: false},
+		{err: &url.Error{Op: "Put", URL: "https://ghcr.io", Err: errors.New("read: connection reset by peer")}, want: true},
+		{err: &url.Error{Op: "Put", URL: "https://ghcr.io", Err: errors.New("x509: certificate signed by unknown authority")}, want: false},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := retryable(context.Background(), test.err)
+
+		if got != test.want {
+			t.Errorf("retryable for %v is %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	// maxDatabase is the maximum size of a package database read from the image.
+	maxDatabase = 64 << 20
+	// maxBinary is the maximum size of an executable inspected for Go build info.
+	maxBinary = 256 << 20
+	// whiteout is the prefix for a file deleted by a layer.
+	whiteout = ".wh."
+	// opaque is the file indicating a directory is replaced by a layer.
+	opaque = ".wh..wh..opq"
+)
+
+// databases are the files read from the image filesystem
+// for the operating system and package databases.
+var databases = []string{
+	"etc/os-release",
+	"usr/lib/os-release",
+	"lib/apk/db/installed",
+	"var/lib/dpkg/status",
+	"var/lib/rpm/Packages",
+	"var/lib/rpm/Packages.db",
+	"var/lib/rpm/rpmdb.sqlite",
+	"usr/lib/sysimage/rpm/Packages.db",
+	"usr/lib/sysimage/rpm/rpmdb.sqlite",
+}
+
+// rootfs represents the files from the image filesystem
+// needed to create the software bill of materials.
+type rootfs struct {
+	// contents of the package databases by path
+	files map[string][]byte
+	// Go build info for the executables by path
+	binaries map[string]*buildinfo.BuildInfo
+}
+
+// newRootfs creates an empty image filesystem.
+func newRootfs() *rootfs {
+	return &rootfs{
+		files:    make(map[string][]byte),
+		binaries: make(map[string]*buildinfo.BuildInfo),
+	}
+}
+
+// isDatabase checks if the file is a package database or os-release file.
+func isDatabase(name string) bool {
+	return contains(databases, name) || strings.HasPrefix(name, "var/lib/dpkg/status.d/")
+}
+
+// isExecutable checks if the magic number is for an executable format
+// that may contain Go build info (ELF, Mach-O or PE).
+func isExecutable(magic []byte) bool {
+	switch {
+	case bytes.HasPrefix(magic, []byte("\x7fELF")):
+		return true
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		return true
+	case bytes.HasPrefix(magic, []byte("\xfe\xed\xfa")), bytes.HasPrefix(magic, []byte("\xfa\xed\xfe")):
+		return true
+	case bytes.HasPrefix(magic, []byte("\xce\xfa\xed\xfe")), bytes.HasPrefix(magic, []byte("\xcf\xfa\xed\xfe")):
+		return true
+	default:
+		return false
+	}
+}
+
+// remove deletes the file and everything within it from the filesystem.
+func (r *rootfs) remove(name string) {
+	for file := range r.files {
+		if file == name || strings.HasPrefix(file, name+"/") {
+			delete(r.files, file)
+		}
+	}
+
+	for file := range r.binaries {
+		if file == name || strings.HasPrefix(file, name+"/") {
+			delete(r.binaries, file)
+		}
+	}
+}
+
+// add records the file in the filesystem when it is a
+// package database or an executable built with Go.
+func (r *rootfs) add(name string, mode os.FileMode, size int64, reader io.Reader) error {
+	// replace any file previously added for the path
+	r.remove(name)
+
+	// check if the file is a regular file
+	if !mode.IsRegular() {
+		return nil
+	}
+
+	// check if the file is a package database
+	if isDatabase(name) {
+		if size > maxDatabase {
+			return fmt.Errorf("package database %s exceeds %d bytes", name, maxDatabase)
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		r.files[name] = data
+
+		return nil
+	}
+
+	// check if the file is an executable
+	if mode&0111 == 0 || size < 4 || size > maxBinary {
+		return nil
+	}
+
+	magic := make([]byte, 4)
+
+	_, err := io.ReadFull(reader, magic)
+	if err != nil {
+		return err
+	}
+
+	if !isExecutable(magic) {
+		return nil
+	}
+
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	info, err := buildinfo.Read(bytes.NewReader(append(magic, rest...)))
+	if err != nil {
+		// skip executables that were not built with Go
+		return nil
+	}
+
+	r.binaries[name] = info
+
+	return nil
+}
+
+// layer applies the tar for a filesystem layer to the filesystem
+// including the files deleted by the layer with whiteouts.
+func (r *rootfs) layer(reader io.Reader) error {
+	reader, err := decompress(reader)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(reader)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read image layer: %w", err)
+		}
+
+		name := cleanName(header.Name)
+		dir, base := path.Split(name)
+
+		switch {
+		case base == opaque:
+			r.remove(strings.TrimSuffix(dir, "/"))
+		case strings.HasPrefix(base, whiteout):
+			r.remove(path.Join(dir, strings.TrimPrefix(base, whiteout)))
+		case header.Typeflag == tar.TypeDir:
+			continue
+		default:
+			err = r.add(name, header.FileInfo().Mode(), header.Size, tr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dir adds the files from the directory containing the filesystem.
+func (r *rootfs) dir(root string) error {
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	return a.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// skip anything that is not a regular file
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+
+		f, err := a.Open(file)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		return r.add(filepath.ToSlash(rel), info.Mode(), info.Size(), f)
+	})
+}
+
+// archiveEntry represents the location of a file within an archive.
+type archiveEntry struct {
+	// offset of the contents for the file
+	offset int64
+	// size of the contents for the file
+	size int64
+}
+
+// archive adds the files from the image archive in the Docker or
+// OCI format or a tar containing the filesystem for the image.
+func (r *rootfs) archive(file string) error {
+	f, err := appFS.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	// variable to store the location of each file in the archive
+	entries := make(map[string]*archiveEntry)
+
+	tr := tar.NewReader(f)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read image archive %s: %w", file, err)
+		}
+
+		// capture the position of the contents since the
+		// tar reader does not read ahead of the header
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		entries[cleanName(header.Name)] = &archiveEntry{offset: offset, size: header.Size}
+	}
+
+	// verify the archive contains the image
+	if len(entries) == 0 {
+		return fmt.Errorf("no files found in image archive %s", file)
+	}
+
+	// variable to store the paths to the layers in the archive
+	var layers []string
+
+	switch {
+	case entries["index.json"] != nil:
+		layers, err = ociLayers(f, entries)
+	case entries["manifest.json"] != nil:
+		layers, err = dockerLayers(f, entries)
+	default:
+		// the archive contains the filesystem for the image
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		return r.layer(f)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to read image archive %s: %w", file, err)
+	}
+
+	for _, layer := range layers {
+		entry, ok := entries[layer]
+		if !ok {
+			return fmt.Errorf("no layer %s found in image archive %s", layer, file)
+		}
+
+		err = r.layer(io.NewSectionReader(f, entry.offset, entry.size))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dockerLayers returns the paths to the layers from the
+// manifest for an image archive in the Docker format.
+func dockerLayers(f io.ReaderAt, entries map[string]*archiveEntry) ([]string, error) {
+	// variable to store the manifest for the archive
+	var manifest []struct {
+		Layers []string `json:"Layers"`
+	}
+
+	err := readEntry(f, entries, "manifest.json", &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(manifest) == 0 {
+		return nil, fmt.Errorf("no images found in manifest.json")
+	}
+
+	// variable to store the paths to the layers
+	layers := make([]string, 0, len(manifest[0].Layers))
+
+	for _, layer := range manifest[0].Layers {
+		layers = append(layers, cleanName(layer))
+	}
+
+	return layers, nil
+}
+
+// ociLayers returns the paths to the layers from the first
+// image manifest for an image archive in the OCI format.
+func ociLayers(f io.ReaderAt, entries map[string]*archiveEntry) ([]string, error) {
+	// variable to store the manifest or index for the archive
+	var manifest struct {
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+
+	err := readEntry(f, entries, "index.json", &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// follow the indexes until an image manifest is found
+	for depth := 0; len(manifest.Manifests) > 0; depth++ {
+		if depth > 4 {
+			return nil, fmt.Errorf("too many nested indexes in image archive")
+		}
+
+		digest := manifest.Manifests[0].Digest
+
+		manifest.Manifests = nil
+
+		err = readEntry(f, entries, blobPath(digest), &manifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// variable to store the paths to the layers
+	layers := make([]string, 0, len(manifest.Layers))
+
+	for _, layer := range manifest.Layers {
+		layers = append(layers, blobPath(layer.Digest))
+	}
+
+	return layers, nil
+}
+
+// readEntry unmarshals the JSON file from the archive.
+func readEntry(f io.ReaderAt, entries map[string]*archiveEntry, name string, v interface{}) error {
+	entry, ok := entries[name]
+	if !ok {
+		return fmt.Errorf("no %s found in image archive", name)
+	}
+
+	// verify the file is a reasonable size for JSON
+	if entry.size > maxDatabase {
+		return fmt.Errorf("%s exceeds %d bytes", name, maxDatabase)
+	}
+
+	return json.NewDecoder(io.NewSectionReader(f, entry.offset, entry.size)).Decode(v)
+}
+
+// blobPath returns the path to the blob in an OCI image layout.
+func blobPath(digest string) string {
+	return path.Join("blobs", strings.Replace(digest, ":", "/", 1))
+}
+
+// cleanName normalizes the path of a file in an archive.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// decompress returns a reader decompressing the contents when they are gzipped.
+func decompress(reader io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+
+	magic, err := buffered.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	// check if the contents are gzipped
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(buffered)
+	}
+
+	return buffered, nil
+}
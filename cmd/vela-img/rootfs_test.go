@@ -0,0 +1,305 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// testTar creates a tar with the provided files where
+// a path ending in a slash creates a directory.
+func testTar(t *testing.T, files [][2]string) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	for _, file := range files {
+		header := &tar.Header{Name: file[0], Mode: 0644, Size: int64(len(file[1])), Typeflag: tar.TypeReg}
+
+		if file[0][len(file[0])-1] == '/' {
+			header = &tar.Header{Name: file[0], Mode: 0755, Typeflag: tar.TypeDir}
+		}
+
+		err := tw.WriteHeader(header)
+		if err != nil {
+			t.Fatalf("unable to write tar header: %v", err)
+		}
+
+		_, err = tw.Write([]byte(file[1]))
+		if err != nil {
+			t.Fatalf("unable to write tar file: %v", err)
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		t.Fatalf("unable to close tar: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// testGzip compresses the provided contents.
+func testGzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+
+	_, err := gw.Write(data)
+	if err != nil {
+		t.Fatalf("unable to write gzip: %v", err)
+	}
+
+	err = gw.Close()
+	if err != nil {
+		t.Fatalf("unable to close gzip: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// paths returns the sorted paths for the files in the filesystem.
+func (r *rootfs) paths() []string {
+	paths := []string{}
+
+	for name := range r.files {
+		paths = append(paths, name)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+func TestImg_rootfs_layer(t *testing.T) {
+	// setup types
+	base := testTar(t, [][2]string{
+		{"etc/", ""},
+		{"etc/os-release", "ID=debian\n"},
+		{"./var/lib/dpkg/status", "Package: base\n"},
+		{"var/lib/dpkg/status.d/foo", "Package: foo\n"},
+		{"var/lib/dpkg/status.d/bar", "Package: bar\n"},
+		{"lib/apk/db/installed", "P:musl\n"},
+		{"etc/hosts", "127.0.0.1 localhost\n"},
+	})
+
+	upper := testTar(t, [][2]string{
+		{"var/lib/dpkg/status.d/.wh..wh..opq", ""},
+		{"var/lib/dpkg/status.d/baz", "Package: baz\n"},
+		{"lib/apk/db/.wh.installed", ""},
+		{"var/lib/dpkg/status", "Package: upper\n"},
+	})
+
+	r := newRootfs()
+
+	// run test
+	err := r.layer(bytes.NewReader(base))
+	if err != nil {
+		t.Errorf("layer returned err: %v", err)
+	}
+
+	err = r.layer(bytes.NewReader(testGzip(t, upper)))
+	if err != nil {
+		t.Errorf("layer returned err: %v", err)
+	}
+
+	want := []string{"etc/os-release", "var/lib/dpkg/status", "var/lib/dpkg/status.d/baz"}
+
+	if got := r.paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("layer is %v, want %v", got, want)
+	}
+
+	if got := string(r.files["var/lib/dpkg/status"]); got != "Package: upper\n" {
+		t.Errorf("layer status is %s, want Package: upper", got)
+	}
+}
+
+func TestImg_rootfs_layer_Invalid(t *testing.T) {
+	// setup types
+	r := newRootfs()
+
+	// run test
+	err := r.layer(bytes.NewReader(testGzip(t, []byte("not a tar archive with enough bytes"))))
+	if err == nil {
+		t.Errorf("layer should have returned err")
+	}
+}
+
+func TestImg_rootfs_add_Executable(t *testing.T) {
+	// setup filesystem
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skipf("unable to find test executable: %v", err)
+	}
+
+	f, err := os.Open(exe)
+	if err != nil {
+		t.Fatalf("unable to open test executable: %v", err)
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("unable to stat test executable: %v", err)
+	}
+
+	r := newRootfs()
+
+	// run test
+	err = r.add("usr/bin/app", info.Mode(), info.Size(), f)
+	if err != nil {
+		t.Errorf("add returned err: %v", err)
+	}
+
+	if r.binaries["usr/bin/app"] == nil {
+		t.Errorf("add should have read the build info for the executable")
+	}
+
+	err = r.add("usr/bin/script", 0755, 14, bytes.NewReader([]byte("#!/bin/sh\nexit")))
+	if err != nil {
+		t.Errorf("add returned err: %v", err)
+	}
+
+	if len(r.binaries) != 1 {
+		t.Errorf("add is %d binaries, want 1", len(r.binaries))
+	}
+}
+
+func TestImg_rootfs_dir(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_ = afero.WriteFile(appFS, "out/etc/os-release", []byte("ID=alpine\n"), 0644)
+	_ = afero.WriteFile(appFS, "out/lib/apk/db/installed", []byte("P:musl\n"), 0644)
+	_ = afero.WriteFile(appFS, "out/etc/hosts", []byte("127.0.0.1 localhost\n"), 0644)
+
+	r := newRootfs()
+
+	// run test
+	err := r.dir("out")
+	if err != nil {
+		t.Errorf("dir returned err: %v", err)
+	}
+
+	want := []string{"etc/os-release", "lib/apk/db/installed"}
+
+	if got := r.paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("dir is %v, want %v", got, want)
+	}
+}
+
+func TestImg_rootfs_archive(t *testing.T) {
+	// setup types
+	base := testTar(t, [][2]string{
+		{"etc/os-release", "ID=alpine\n"},
+		{"lib/apk/db/installed", "P:musl\n"},
+	})
+
+	upper := testGzip(t, testTar(t, [][2]string{
+		{"lib/apk/db/installed", "P:busybox\n"},
+	}))
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"layers": []map[string]string{
+			{"digest": "sha256:base"},
+			{"digest": "sha256:upper"},
+		},
+	})
+
+	index, _ := json.Marshal(map[string]interface{}{
+		"manifests": []map[string]string{{"digest": "sha256:manifest"}},
+	})
+
+	docker, _ := json.Marshal([]map[string]interface{}{
+		{"Layers": []string{"base/layer.tar", "upper/layer.tar"}},
+	})
+
+	tests := []struct {
+		name    string
+		archive []byte
+		want    string
+		failure bool
+	}{
+		{
+			name: "oci",
+			archive: testTar(t, [][2]string{
+				{"oci-layout", `{"imageLayoutVersion":"1.0.0"}`},
+				{"index.json", string(index)},
+				{"blobs/sha256/manifest", string(manifest)},
+				{"blobs/sha256/base", string(base)},
+				{"blobs/sha256/upper", string(upper)},
+			}),
+			want: "P:busybox\n",
+		},
+		{
+			name: "docker",
+			archive: testTar(t, [][2]string{
+				{"manifest.json", string(docker)},
+				{"base/layer.tar", string(base)},
+				{"upper/layer.tar", string(upper)},
+			}),
+			want: "P:busybox\n",
+		},
+		{
+			name:    "rootfs",
+			archive: base,
+			want:    "P:musl\n",
+		},
+		{
+			name: "missing layer",
+			archive: testTar(t, [][2]string{
+				{"manifest.json", string(docker)},
+				{"base/layer.tar", string(base)},
+			}),
+			failure: true,
+		},
+	}
+
+	// run tests
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// setup filesystem
+			appFS = afero.NewMemMapFs()
+
+			_ = afero.WriteFile(appFS, "image.tar", test.archive, 0644)
+
+			r := newRootfs()
+
+			err := r.archive("image.tar")
+
+			if test.failure {
+				if err == nil {
+					t.Errorf("archive should have returned err")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Errorf("archive returned err: %v", err)
+			}
+
+			if got := string(r.files["lib/apk/db/installed"]); got != test.want {
+				t.Errorf("archive is %s, want %s", got, test.want)
+			}
+
+			if got := string(r.files["etc/os-release"]); got != "ID=alpine\n" {
+				t.Errorf("archive os-release is %s, want ID=alpine", got)
+			}
+		})
+	}
+}
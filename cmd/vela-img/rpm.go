@@ -0,0 +1,483 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// sqliteMagic is the header at the start of a SQLite database.
+	sqliteMagic = "SQLite format 3\x00"
+	// maxSQLiteDepth is the maximum depth of a b-tree read from a SQLite database.
+	maxSQLiteDepth = 16
+)
+
+const (
+	// rpmTagName is the tag for the name of the package in the rpm header.
+	rpmTagName = 1000
+	// rpmTagVersion is the tag for the version of the package in the rpm header.
+	rpmTagVersion = 1001
+	// rpmTagRelease is the tag for the release of the package in the rpm header.
+	rpmTagRelease = 1002
+	// rpmTagEpoch is the tag for the epoch of the package in the rpm header.
+	rpmTagEpoch = 1003
+	// rpmTagArch is the tag for the architecture of the package in the rpm header.
+	rpmTagArch = 1022
+
+	// rpmTypeInt32 is the type for an integer value in the rpm header.
+	rpmTypeInt32 = 4
+	// rpmTypeString is the type for a string value in the rpm header.
+	rpmTypeString = 6
+)
+
+// rpmPackages parses the installed packages from the rpm
+// package database stored in the SQLite format.
+func rpmPackages(location, distro string, data []byte) ([]*sbomPackage, error) {
+	blobs, err := sqliteTable(data, "Packages")
+	if err != nil {
+		return nil, err
+	}
+
+	// variable to store the packages
+	var packages []*sbomPackage
+
+	for _, blob := range blobs {
+		p, err := rpmHeader(blob)
+		if err != nil {
+			return nil, err
+		}
+
+		// skip the public keys imported into the database
+		if p.Name == "gpg-pubkey" {
+			continue
+		}
+
+		p.Location = location
+		p.PURL = purl("rpm", distro, p.Name, p.Version, p.Arch)
+
+		// the epoch is a qualifier for the package URL
+		if epoch, version, ok := strings.Cut(p.Version, ":"); ok {
+			p.PURL = purl("rpm", distro, p.Name, version, p.Arch)
+
+			if len(p.Arch) > 0 {
+				p.PURL += "&epoch=" + epoch
+			} else {
+				p.PURL += "?epoch=" + epoch
+			}
+		}
+
+		packages = append(packages, p)
+	}
+
+	return packages, nil
+}
+
+// rpmHeader parses the package from the rpm header stored in the database.
+func rpmHeader(blob []byte) (*sbomPackage, error) {
+	// check if the header includes the index and data lengths
+	if len(blob) < 8 {
+		return nil, fmt.Errorf("rpm header is too short")
+	}
+
+	entries := int(binary.BigEndian.Uint32(blob[0:4]))
+	size := int(binary.BigEndian.Uint32(blob[4:8]))
+
+	// the data follows the index with 16 bytes for each entry
+	start := 8 + entries*16
+
+	if entries < 0 || size < 0 || start < 8 || start+size > len(blob) {
+		return nil, fmt.Errorf("rpm header has an invalid length")
+	}
+
+	data := blob[start : start+size]
+
+	// variable to store the values for the tags
+	values := make(map[int]string)
+
+	for i := 0; i < entries; i++ {
+		entry := blob[8+i*16 : 24+i*16]
+
+		tag := int(binary.BigEndian.Uint32(entry[0:4]))
+		kind := binary.BigEndian.Uint32(entry[4:8])
+		offset := int(binary.BigEndian.Uint32(entry[8:12]))
+
+		// check if the offset is within the data
+		if offset < 0 || offset >= len(data) {
+			continue
+		}
+
+		switch {
+		case kind == rpmTypeString:
+			value := data[offset:]
+
+			// strings are terminated by a null byte
+			if end := bytes.IndexByte(value, 0); end >= 0 {
+				value = value[:end]
+			}
+
+			values[tag] = string(value)
+		case kind == rpmTypeInt32 && offset+4 <= len(data):
+			values[tag] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(data[offset:offset+4])), 10)
+		}
+	}
+
+	// check if the header is for a package
+	if len(values[rpmTagName]) == 0 {
+		return nil, fmt.Errorf("no package name found in rpm header")
+	}
+
+	// variable to store the version in the 'epoch:version-release' format
+	version := values[rpmTagVersion]
+
+	if len(values[rpmTagRelease]) > 0 {
+		version = fmt.Sprintf("%s-%s", version, values[rpmTagRelease])
+	}
+
+	if epoch := values[rpmTagEpoch]; len(epoch) > 0 && epoch != "0" {
+		version = fmt.Sprintf("%s:%s", epoch, version)
+	}
+
+	return &sbomPackage{
+		Arch:    values[rpmTagArch],
+		Name:    values[rpmTagName],
+		Type:    "rpm",
+		Version: version,
+	}, nil
+}
+
+// sqliteDatabase represents a read-only SQLite database file.
+type sqliteDatabase struct {
+	// contents of the database file
+	data []byte
+	// size of each page in the database
+	pageSize int
+	// size of each page usable for the b-tree
+	usable int
+}
+
+// sqliteTable returns the values from the last column of
+// each row in the table from the SQLite database.
+func sqliteTable(data []byte, table string) ([][]byte, error) {
+	// check if the file is a SQLite database
+	if len(data) < 100 || string(data[:16]) != sqliteMagic {
+		return nil, fmt.Errorf("file is not a sqlite database")
+	}
+
+	db := &sqliteDatabase{
+		data:     data,
+		pageSize: int(binary.BigEndian.Uint16(data[16:18])),
+	}
+
+	// a page size of 1 is used for 65536 bytes
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+
+	db.usable = db.pageSize - int(data[20])
+
+	if db.pageSize < 512 || db.usable < 480 {
+		return nil, fmt.Errorf("sqlite database has an invalid page size %d", db.pageSize)
+	}
+
+	// the schema for the database is stored in the first page
+	schema, err := db.rows(1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range schema {
+		// the schema has the type, name, table, root page and sql for each object
+		if len(row) < 4 || string(row[0].text) != "table" || string(row[1].text) != table {
+			continue
+		}
+
+		rows, err := db.rows(int(row[3].integer), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		// variable to store the values from the last column
+		values := make([][]byte, 0, len(rows))
+
+		for _, r := range rows {
+			if len(r) > 0 {
+				values = append(values, r[len(r)-1].text)
+			}
+		}
+
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("no %s table found in sqlite database", table)
+}
+
+// sqliteValue represents a column in a row from a SQLite table.
+type sqliteValue struct {
+	// value for integer columns
+	integer int64
+	// value for text and blob columns
+	text []byte
+}
+
+// page returns the contents of the page in the database.
+func (db *sqliteDatabase) page(number int) ([]byte, error) {
+	start := (number - 1) * db.pageSize
+
+	if number < 1 || start+db.pageSize > len(db.data) {
+		return nil, fmt.Errorf("sqlite page %d is out of range", number)
+	}
+
+	return db.data[start : start+db.pageSize], nil
+}
+
+// rows returns the rows from the table b-tree starting at the page.
+func (db *sqliteDatabase) rows(number, depth int) ([][]sqliteValue, error) {
+	if depth > maxSQLiteDepth {
+		return nil, fmt.Errorf("sqlite b-tree is too deep")
+	}
+
+	page, err := db.page(number)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first page starts with the header for the database
+	header := 0
+	if number == 1 {
+		header = 100
+	}
+
+	kind := page[header]
+	cells := int(binary.BigEndian.Uint16(page[header+3 : header+5]))
+
+	// variable to store the rows
+	var rows [][]sqliteValue
+
+	switch kind {
+	// interior table page
+	case 0x05:
+		pointers := header + 12
+
+		if pointers+cells*2 > len(page) {
+			return nil, fmt.Errorf("sqlite page %d has an invalid cell count", number)
+		}
+
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(page[pointers+i*2:]))
+
+			if offset+4 > len(page) {
+				return nil, fmt.Errorf("sqlite page %d has an invalid cell offset", number)
+			}
+
+			children, err := db.rows(int(binary.BigEndian.Uint32(page[offset:])), depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			rows = append(rows, children...)
+		}
+
+		children, err := db.rows(int(binary.BigEndian.Uint32(page[header+8:])), depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(rows, children...), nil
+	// leaf table page
+	case 0x0d:
+		pointers := header + 8
+
+		if pointers+cells*2 > len(page) {
+			return nil, fmt.Errorf("sqlite page %d has an invalid cell count", number)
+		}
+
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(page[pointers+i*2:]))
+
+			payload, err := db.payload(page, offset)
+			if err != nil {
+				return nil, fmt.Errorf("sqlite page %d: %w", number, err)
+			}
+
+			row, err := sqliteRecord(payload)
+			if err != nil {
+				return nil, fmt.Errorf("sqlite page %d: %w", number, err)
+			}
+
+			rows = append(rows, row)
+		}
+
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("sqlite page %d is not a table page", number)
+	}
+}
+
+// payload returns the record for the cell in the leaf table
+// page including the content stored in overflow pages.
+func (db *sqliteDatabase) payload(page []byte, offset int) ([]byte, error) {
+	if offset >= len(page) {
+		return nil, fmt.Errorf("invalid cell offset %d", offset)
+	}
+
+	size, n := sqliteVarint(page[offset:])
+	offset += n
+
+	// skip the row id for the cell
+	_, m := sqliteVarint(page[offset:])
+	offset += m
+
+	if n == 0 || m == 0 || size < 0 || size > maxDatabase {
+		return nil, fmt.Errorf("invalid cell size %d", size)
+	}
+
+	total := int(size)
+
+	// calculate the content stored within the page
+	// https://www.sqlite.org/fileformat.html#b_tree_pages
+	local := total
+	maxLocal := db.usable - 35
+
+	if total > maxLocal {
+		minLocal := (db.usable-12)*32/255 - 23
+
+		local = minLocal + (total-minLocal)%(db.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+
+	if offset+local > len(page) {
+		return nil, fmt.Errorf("cell exceeds the page")
+	}
+
+	payload := make([]byte, 0, total)
+	payload = append(payload, page[offset:offset+local]...)
+
+	// check if the content continues in overflow pages
+	if local < total {
+		if offset+local+4 > len(page) {
+			return nil, fmt.Errorf("cell exceeds the page")
+		}
+
+		next := int(binary.BigEndian.Uint32(page[offset+local:]))
+
+		for len(payload) < total {
+			overflow, err := db.page(next)
+			if err != nil {
+				return nil, err
+			}
+
+			remaining := total - len(payload)
+			if remaining > db.usable-4 {
+				remaining = db.usable - 4
+			}
+
+			payload = append(payload, overflow[4:4+remaining]...)
+
+			next = int(binary.BigEndian.Uint32(overflow[0:4]))
+		}
+	}
+
+	return payload, nil
+}
+
+// sqliteRecord parses the columns from the record.
+// https://www.sqlite.org/fileformat.html#record_format
+func sqliteRecord(payload []byte) ([]sqliteValue, error) {
+	size, n := sqliteVarint(payload)
+
+	if size < int64(n) || size > int64(len(payload)) {
+		return nil, fmt.Errorf("invalid record header")
+	}
+
+	// variable to store the serial types for the columns
+	var types []int64
+
+	for offset := n; offset < int(size); {
+		kind, n := sqliteVarint(payload[offset:size])
+		if n == 0 {
+			return nil, fmt.Errorf("invalid record header")
+		}
+
+		types = append(types, kind)
+		offset += n
+	}
+
+	// variable to store the columns
+	columns := make([]sqliteValue, 0, len(types))
+
+	offset := int(size)
+
+	for _, kind := range types {
+		// variable to store the length of the column
+		var length int
+
+		switch {
+		case kind >= 1 && kind <= 4:
+			length = int(kind)
+		case kind == 5:
+			length = 6
+		case kind == 6, kind == 7:
+			length = 8
+		case kind >= 12:
+			length = int((kind - 12) / 2)
+		}
+
+		if length < 0 || offset+length > len(payload) {
+			return nil, fmt.Errorf("record exceeds the payload")
+		}
+
+		value := payload[offset : offset+length]
+		offset += length
+
+		switch {
+		case kind >= 1 && kind <= 6:
+			// integers are stored as big-endian two's complement
+			integer := int64(int8(value[0]))
+
+			for _, b := range value[1:] {
+				integer = integer<<8 | int64(b)
+			}
+
+			columns = append(columns, sqliteValue{integer: integer})
+		case kind == 9:
+			columns = append(columns, sqliteValue{integer: 1})
+		case kind >= 12:
+			columns = append(columns, sqliteValue{text: value})
+		default:
+			columns = append(columns, sqliteValue{})
+		}
+	}
+
+	return columns, nil
+}
+
+// sqliteVarint returns the variable-length integer at the start
+// of the data and the number of bytes used to store it.
+func sqliteVarint(data []byte) (int64, int) {
+	// variable to store the integer
+	var value int64
+
+	for i := 0; i < 9 && i < len(data); i++ {
+		// the ninth byte uses all eight bits
+		if i == 8 {
+			return value<<8 | int64(data[i]), 9
+		}
+
+		value = value<<7 | int64(data[i]&0x7f)
+
+		if data[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+
+	return value, 0
+}
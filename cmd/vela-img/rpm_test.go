@@ -0,0 +1,285 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testPageSize is the size of each page in the SQLite databases created for the tests.
+const testPageSize = 512
+
+// testRPMHeader creates the rpm header stored in the database for the package.
+func testRPMHeader(name, version, release, arch string, epoch uint32) []byte {
+	// variable to store the index and data for the header
+	var index, data bytes.Buffer
+
+	for _, tag := range []struct {
+		tag   uint32
+		value string
+	}{
+		{tag: rpmTagName, value: name},
+		{tag: rpmTagVersion, value: version},
+		{tag: rpmTagRelease, value: release},
+		{tag: rpmTagArch, value: arch},
+	} {
+		_ = binary.Write(&index, binary.BigEndian, []uint32{tag.tag, rpmTypeString, uint32(data.Len()), 1})
+
+		data.WriteString(tag.value)
+		data.WriteByte(0)
+	}
+
+	// check if an epoch is provided
+	if epoch > 0 {
+		// integers are aligned to four bytes
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+
+		_ = binary.Write(&index, binary.BigEndian, []uint32{rpmTagEpoch, rpmTypeInt32, uint32(data.Len()), 1})
+		_ = binary.Write(&data, binary.BigEndian, epoch)
+	}
+
+	header := make([]byte, 8)
+
+	binary.BigEndian.PutUint32(header[0:4], uint32(index.Len()/16))
+	binary.BigEndian.PutUint32(header[4:8], uint32(data.Len()))
+
+	return append(append(header, index.Bytes()...), data.Bytes()...)
+}
+
+// testVarint encodes the variable-length integer used by SQLite.
+func testVarint(value int) []byte {
+	// variable to store the seven bit groups from the lowest
+	groups := []byte{byte(value & 0x7f)}
+
+	for value >>= 7; value > 0; value >>= 7 {
+		groups = append([]byte{byte(value&0x7f) | 0x80}, groups...)
+	}
+
+	return groups
+}
+
+// testUint32 encodes the page number for the SQLite database.
+func testUint32(value int) []byte {
+	data := make([]byte, 4)
+
+	binary.BigEndian.PutUint32(data, uint32(value))
+
+	return data
+}
+
+// testRecord encodes the columns as a SQLite record where
+// nil is stored as NULL, integers as a single byte and
+// strings as text.
+func testRecord(columns ...interface{}) []byte {
+	// variable to store the serial types and values for the columns
+	var types, values []byte
+
+	for _, column := range columns {
+		switch v := column.(type) {
+		case nil:
+			types = append(types, testVarint(0)...)
+		case int:
+			types = append(types, testVarint(1)...)
+			values = append(values, byte(v))
+		case string:
+			types = append(types, testVarint(len(v)*2+13)...)
+			values = append(values, v...)
+		case []byte:
+			types = append(types, testVarint(len(v)*2+12)...)
+			values = append(values, v...)
+		}
+	}
+
+	// the size of the header includes itself
+	header := append(testVarint(len(types)+1), types...)
+
+	return append(header, values...)
+}
+
+// testRPMDatabase creates the rpm package database in the SQLite format
+// with a leaf page for each header and overflow pages for large headers.
+func testRPMDatabase(t *testing.T, headers [][]byte) []byte {
+	t.Helper()
+
+	// the schema and the root of the Packages table are the first two pages
+	pages := [][]byte{make([]byte, testPageSize), make([]byte, testPageSize)}
+
+	// variable to store the leaf page for each header
+	var leaves []int
+
+	for i, header := range headers {
+		payload := testRecord(nil, header)
+
+		// calculate the content stored within the leaf page
+		local := len(payload)
+		maxLocal := testPageSize - 35
+		minLocal := (testPageSize-12)*32/255 - 23
+
+		if local > maxLocal {
+			local = minLocal + (len(payload)-minLocal)%(testPageSize-4)
+			if local > maxLocal {
+				local = minLocal
+			}
+		}
+
+		cell := append(testVarint(len(payload)), testVarint(i+1)...)
+		cell = append(cell, payload[:local]...)
+
+		rest := payload[local:]
+
+		// check if the content continues in overflow pages
+		if len(rest) > 0 {
+			cell = append(cell, testUint32(len(pages)+2)...)
+		}
+
+		leaf := make([]byte, testPageSize)
+		leaf[0] = 0x0d
+
+		binary.BigEndian.PutUint16(leaf[3:5], 1)
+		binary.BigEndian.PutUint16(leaf[8:10], uint16(testPageSize-len(cell)))
+		copy(leaf[testPageSize-len(cell):], cell)
+
+		pages = append(pages, leaf)
+		leaves = append(leaves, len(pages))
+
+		for len(rest) > 0 {
+			overflow := make([]byte, testPageSize)
+
+			n := copy(overflow[4:], rest)
+			rest = rest[n:]
+
+			if len(rest) > 0 {
+				binary.BigEndian.PutUint32(overflow[0:4], uint32(len(pages)+2))
+			}
+
+			pages = append(pages, overflow)
+		}
+	}
+
+	// create the interior page pointing to each leaf page
+	root := pages[1]
+	root[0] = 0x05
+
+	binary.BigEndian.PutUint16(root[3:5], uint16(len(leaves)-1))
+	binary.BigEndian.PutUint32(root[8:12], uint32(leaves[len(leaves)-1]))
+
+	end := testPageSize
+
+	for i, leaf := range leaves[:len(leaves)-1] {
+		cell := append(testUint32(leaf), testVarint(i+1)...)
+
+		end -= len(cell)
+
+		copy(root[end:], cell)
+		binary.BigEndian.PutUint16(root[12+i*2:], uint16(end))
+	}
+
+	// create the first page with the header and schema for the database
+	schema := pages[0]
+
+	copy(schema, sqliteMagic)
+	binary.BigEndian.PutUint16(schema[16:18], testPageSize)
+
+	cell := testRecord("table", "Packages", "Packages", 2, "CREATE TABLE 'Packages' (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)")
+	cell = append(append(testVarint(len(cell)), testVarint(1)...), cell...)
+
+	schema[100] = 0x0d
+
+	binary.BigEndian.PutUint16(schema[103:105], 1)
+	binary.BigEndian.PutUint16(schema[108:110], uint16(testPageSize-len(cell)))
+	copy(schema[testPageSize-len(cell):], cell)
+
+	return bytes.Join(pages, nil)
+}
+
+func TestImg_rpmPackages(t *testing.T) {
+	// setup types
+	data := testRPMDatabase(t, [][]byte{
+		testRPMHeader("bash", "5.1.8", "6.el9", "x86_64", 0),
+		testRPMHeader("gpg-pubkey", "fd431d51", "4ae0493b", "", 0),
+		// the long release is stored in overflow pages
+		testRPMHeader("openssl-libs", "3.0.7", string(bytes.Repeat([]byte("1"), 1200)), "x86_64", 1),
+	})
+
+	want := []*sbomPackage{
+		{
+			Arch:     "x86_64",
+			Location: "var/lib/rpm/rpmdb.sqlite",
+			Name:     "bash",
+			PURL:     "pkg:rpm/rhel/bash@5.1.8-6.el9?arch=x86_64",
+			Type:     "rpm",
+			Version:  "5.1.8-6.el9",
+		},
+		{
+			Arch:     "x86_64",
+			Location: "var/lib/rpm/rpmdb.sqlite",
+			Name:     "openssl-libs",
+			PURL:     "pkg:rpm/rhel/openssl-libs@3.0.7-" + string(bytes.Repeat([]byte("1"), 1200)) + "?arch=x86_64&epoch=1",
+			Type:     "rpm",
+			Version:  "1:3.0.7-" + string(bytes.Repeat([]byte("1"), 1200)),
+		},
+	}
+
+	// run test
+	got, err := rpmPackages("var/lib/rpm/rpmdb.sqlite", "rhel", data)
+	if err != nil {
+		t.Errorf("rpmPackages returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rpmPackages is %v, want %v", got, want)
+	}
+}
+
+func TestImg_rpmPackages_Invalid(t *testing.T) {
+	// setup types
+	valid := testRPMDatabase(t, [][]byte{testRPMHeader("bash", "5.1.8", "6.el9", "x86_64", 0)})
+
+	// setup tests
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "berkeley db", data: []byte("\x00\x06\x15\x61")},
+		{name: "truncated", data: valid[:testPageSize+16]},
+		{name: "invalid header", data: testRPMDatabase(t, [][]byte{[]byte("foo")})},
+	}
+
+	// run tests
+	for _, test := range tests {
+		_, err := rpmPackages("var/lib/rpm/rpmdb.sqlite", "rhel", test.data)
+		if err == nil {
+			t.Errorf("rpmPackages for %s should have returned err", test.name)
+		}
+	}
+}
+
+func TestImg_sqliteVarint(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		data  []byte
+		want  int64
+		wantN int
+	}{
+		{data: []byte{0x05}, want: 5, wantN: 1},
+		{data: []byte{0x81, 0x00}, want: 128, wantN: 2},
+		{data: testVarint(300000), want: 300000, wantN: 3},
+		{data: []byte{0x81}, want: 1, wantN: 0},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got, n := sqliteVarint(test.data)
+
+		if got != test.want || n != test.wantN {
+			t.Errorf("sqliteVarint for %x is %d (%d bytes), want %d (%d bytes)", test.data, got, n, test.want, test.wantN)
+		}
+	}
+}
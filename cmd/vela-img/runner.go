@@ -0,0 +1,152 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// stderrLimit is the maximum number of bytes
+// captured from the stderr for a process.
+const stderrLimit = 64 << 10
+
+// terminateDelay is the duration to wait for a process to exit
+// after it is terminated before the process is killed.
+var terminateDelay = 10 * time.Second
+
+// Runner represents the interface for running the programs for the plugin.
+type Runner interface {
+	// Run executes the program with the provided arguments and
+	// input and returns the output captured from the program.
+	Run(ctx context.Context, name string, args []string, stdin io.Reader) ([]byte, error)
+}
+
+// exitError represents a program that failed along with
+// the last output the program wrote to stderr.
+type exitError struct {
+	// error returned from the program
+	err error
+	// output captured from the stderr for the program
+	stderr []byte
+}
+
+// Error returns the error from the program.
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error from the program.
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// tailBuffer stores the last bytes written up to the limit.
+type tailBuffer struct {
+	// maximum number of bytes stored
+	limit int
+	// bytes stored in the buffer
+	data []byte
+}
+
+// Write appends the bytes and discards the oldest bytes over the limit.
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.data = append(t.data, p...)
+
+	// check if the buffer is over the limit
+	if len(t.data) > t.limit {
+		t.data = append([]byte(nil), t.data[len(t.data)-t.limit:]...)
+	}
+
+	return len(p), nil
+}
+
+// execRunner runs the programs as processes on the host.
+type execRunner struct{}
+
+// Run executes the program as a process streaming the output
+// to the OS stdout and stderr while capturing the stdout. When the
+// program fails, the end of the stderr is captured with the error.
+//
+// When the context ends, the process group for the program is
+// terminated and then killed if it does not exit in time.
+func (r *execRunner) Run(ctx context.Context, name string, args []string, stdin io.Reader) ([]byte, error) {
+	// check if the context has already ended
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// variable to store the output from the process
+	var stdout bytes.Buffer
+
+	// variable to store the end of the errors from the process
+	stderr := &tailBuffer{limit: stderrLimit}
+
+	// nolint:gosec // this functionality is not exploitable the way
+	// the plugin accepts configuration
+	e := exec.Command(name, args...)
+
+	// set command stdin to the provided input
+	e.Stdin = stdin
+	// set command stdout to OS stdout and the captured output
+	e.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	// set command stderr to OS stderr and the captured errors
+	e.Stderr = io.MultiWriter(os.Stderr, stderr)
+
+	// run the process in a separate process group
+	setProcessGroup(e)
+
+	err := e.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	// variable to store the result of waiting for the process
+	done := make(chan error, 1)
+
+	go func() {
+		done <- e.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			return stdout.Bytes(), &exitError{err: err, stderr: stderr.data}
+		}
+
+		return stdout.Bytes(), nil
+	case <-ctx.Done():
+	}
+
+	logrus.Warnf("terminating %s: %v", filepath.Base(name), ctx.Err())
+
+	err = terminate(e.Process)
+	if err != nil {
+		logrus.Debugf("unable to terminate %s: %v", filepath.Base(name), err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(terminateDelay):
+		logrus.Warnf("killing %s after %s", filepath.Base(name), terminateDelay)
+
+		err = kill(e.Process)
+		if err != nil {
+			logrus.Debugf("unable to kill %s: %v", filepath.Base(name), err)
+		}
+
+		<-done
+	}
+
+	return stdout.Bytes(), fmt.Errorf("%s terminated: %w", filepath.Base(name), ctx.Err())
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRunner records the programs run for the plugin
+// and returns the configured output and error.
+type fakeRunner struct {
+	sync.Mutex
+
+	// programs and arguments that were run
+	calls [][]string
+	// input provided to the programs that were run
+	stdin []string
+
+	// output returned for every program
+	output []byte
+	// errors returned in order before the error for every program
+	errs []error
+	// error returned for every program
+	err error
+	// block every program until the context ends
+	block bool
+}
+
+// Run records the program and returns the configured output and error.
+func (f *fakeRunner) Run(ctx context.Context, name string, args []string, stdin io.Reader) ([]byte, error) {
+	// check if the program should block
+	if f.block {
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.calls = append(f.calls, append([]string{name}, args...))
+
+	// check if input is provided
+	if stdin != nil {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+
+		f.stdin = append(f.stdin, string(data))
+	}
+
+	// check if an error is provided for the program
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+
+		return f.output, err
+	}
+
+	return f.output, f.err
+}
+
+func TestImg_execRunner_Run(t *testing.T) {
+	// setup types
+	r := new(execRunner)
+
+	got, err := r.Run(context.Background(), "echo", []string{"hello"}, nil)
+	if err != nil {
+		t.Errorf("Run returned err: %v", err)
+	}
+
+	if strings.TrimSpace(string(got)) != "hello" {
+		t.Errorf("Run output is %s, want hello", got)
+	}
+}
+
+func TestImg_execRunner_Run_Stdin(t *testing.T) {
+	// setup types
+	r := new(execRunner)
+
+	got, err := r.Run(context.Background(), "cat", nil, strings.NewReader("hello"))
+	if err != nil {
+		t.Errorf("Run returned err: %v", err)
+	}
+
+	if string(got) != "hello" {
+		t.Errorf("Run output is %s, want hello", got)
+	}
+}
+
+func TestImg_execRunner_Run_Error(t *testing.T) {
+	// setup types
+	r := new(execRunner)
+
+	_, err := r.Run(context.Background(), "/path/to/nowhere", nil, nil)
+	if err == nil {
+		t.Errorf("Run should have returned err")
+	}
+}
+
+func TestImg_execRunner_Run_Stderr(t *testing.T) {
+	// setup types
+	r := new(execRunner)
+
+	_, err := r.Run(context.Background(), "sh", []string{"-c", "echo 502 Bad Gateway >&2; exit 1"}, nil)
+
+	// variable to store the error from the program
+	var e *exitError
+
+	if !errors.As(err, &e) {
+		t.Fatalf("Run returned err %v, want exitError", err)
+	}
+
+	if strings.TrimSpace(string(e.stderr)) != "502 Bad Gateway" {
+		t.Errorf("Run stderr is %s, want 502 Bad Gateway", e.stderr)
+	}
+}
+
+func TestImg_tailBuffer_Write(t *testing.T) {
+	// setup types
+	b := &tailBuffer{limit: 5}
+
+	for _, value := range []string{"hello", " ", "world"} {
+		_, _ = b.Write([]byte(value))
+	}
+
+	if string(b.data) != "world" {
+		t.Errorf("tailBuffer is %s, want world", b.data)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup configures the command to run in a new process
+// group so the children of the process can be signaled with it.
+func setProcessGroup(e *exec.Cmd) {
+	e.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate sends SIGTERM to the process group for the process.
+func terminate(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGTERM)
+}
+
+// kill sends SIGKILL to the process group for the process.
+func kill(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestImg_execRunner_Run_Timeout(t *testing.T) {
+	// setup types
+	r := new(execRunner)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := r.Run(ctx, "sh", []string{"-c", "sleep 10 & wait"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run returned err %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Run did not terminate the process group")
+	}
+}
+
+func TestImg_execRunner_Run_Kill(t *testing.T) {
+	// setup types
+	r := new(execRunner)
+
+	delay := terminateDelay
+	terminateDelay = 100 * time.Millisecond
+
+	defer func() { terminateDelay = delay }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := r.Run(ctx, "sh", []string{"-c", "trap '' TERM; sleep 10"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run returned err %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Run did not kill the process group")
+	}
+}
+
+func TestImg_execRunner_Run_Canceled(t *testing.T) {
+	// setup types
+	r := new(execRunner)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.Run(ctx, "echo", []string{"hello"}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run returned err %v, want %v", err, context.Canceled)
+	}
+}
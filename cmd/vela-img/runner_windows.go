@@ -0,0 +1,26 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op since process groups
+// can not be signaled on Windows.
+func setProcessGroup(e *exec.Cmd) {}
+
+// terminate kills the process since Windows does not support SIGTERM.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
+
+// kill kills the process.
+func kill(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,588 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// saveAction writes the image stored by img to an archive.
+const saveAction = "save"
+
+const (
+	// sbomSPDX writes the software bill of materials in the SPDX format.
+	sbomSPDX = "spdx"
+	// sbomCycloneDX writes the software bill of materials in the CycloneDX format.
+	sbomCycloneDX = "cyclonedx"
+)
+
+// sbomPackage represents a package found in the image filesystem.
+type sbomPackage struct {
+	// architecture the package was built for
+	Arch string
+	// path to the database or executable the package was found in
+	Location string
+	// name of the package
+	Name string
+	// package URL identifying the package
+	PURL string
+	// ecosystem for the package (apk|deb|rpm|golang)
+	Type string
+	// version of the package
+	Version string
+}
+
+// sbomFile returns the path to write the software bill of materials to.
+func (b *Build) sbomFile() string {
+	// check if SBOMFile is provided
+	if len(b.SBOMFile) > 0 {
+		return b.SBOMFile
+	}
+
+	// check if the CycloneDX format is used
+	if b.SBOM == sbomCycloneDX {
+		return "sbom.cdx.json"
+	}
+
+	return "sbom.spdx.json"
+}
+
+// validateSBOM verifies the software bill of materials can be
+// created from the image filesystem output by the build.
+func (b *Build) validateSBOM() error {
+	switch b.SBOM {
+	case "":
+		return nil
+	case sbomSPDX, sbomCycloneDX:
+	default:
+		return fmt.Errorf("invalid build sbom format provided: %s", b.SBOM)
+	}
+
+	// verify a single platform is built since the sbom
+	// is created from the first image in the archive
+	if len(b.Platforms) > 1 {
+		return fmt.Errorf("build sbom is not supported for multiple platforms: %s", strings.Join(b.Platforms, ","))
+	}
+
+	// check if Output is provided
+	if len(b.Output) == 0 {
+		return nil
+	}
+
+	switch specFields(b.Output)["type"] {
+	case "tar", "docker", "oci", "local":
+		return nil
+	default:
+		return fmt.Errorf("build output %s is not supported for the sbom", b.Output)
+	}
+}
+
+// writeSBOM creates the software bill of materials from
+// the image filesystem and writes it to the workspace.
+func (b *Build) writeSBOM(ctx context.Context) error {
+	logrus.Infof("creating %s sbom for image %s", b.SBOM, b.Name())
+
+	// write the image to the archive when not written by the build
+	err := b.backend().Save(ctx, b)
+	if err != nil {
+		return fmt.Errorf("unable to save image for sbom: %w", err)
+	}
+
+	fs := newRootfs()
+
+	// check if Output is provided
+	if len(b.Output) == 0 {
+		err = fs.archive(b.archive)
+	} else if fields := specFields(b.Output); fields["type"] == "local" {
+		err = fs.dir(fields["dest"])
+	} else {
+		err = fs.archive(fields["dest"])
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to inspect image for sbom: %w", err)
+	}
+
+	packages := fs.packages()
+
+	// variable to store the software bill of materials
+	var doc interface{}
+
+	switch b.SBOM {
+	case sbomCycloneDX:
+		doc = newCycloneDX(b.Name(), b.digest, packages)
+	default:
+		doc = newSPDX(b.Name(), b.digest, packages)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// check if the path includes a directory
+	if dir := filepath.Dir(b.sbomFile()); dir != "." {
+		err = a.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.WriteFile(b.sbomFile(), append(data, '\n'), 0644)
+}
+
+// packages returns the packages found in the package
+// databases and Go executables in the filesystem.
+func (r *rootfs) packages() []*sbomPackage {
+	distro := r.distro()
+
+	// variable to store the packages
+	var packages []*sbomPackage
+
+	for name, data := range r.files {
+		switch {
+		case name == "lib/apk/db/installed":
+			packages = append(packages, apkPackages(name, distro, data)...)
+		case name == "var/lib/dpkg/status", strings.HasPrefix(name, "var/lib/dpkg/status.d/"):
+			packages = append(packages, dpkgPackages(name, distro, data)...)
+		case strings.HasSuffix(name, "/rpmdb.sqlite"):
+			rpms, err := rpmPackages(name, distro, data)
+			if err != nil {
+				logrus.Warnf("unable to read rpm database %s - rpm packages are not included in the sbom: %v", name, err)
+
+				continue
+			}
+
+			packages = append(packages, rpms...)
+		case strings.Contains(name, "/rpm/"):
+			logrus.Warnf("rpm database %s is not in the sqlite format - rpm packages are not included in the sbom", name)
+		}
+	}
+
+	for name, info := range r.binaries {
+		// check if the main module is known
+		if len(info.Main.Path) > 0 {
+			packages = append(packages, goPackage(name, info.Main.Path, info.Main.Version))
+		}
+
+		for _, dep := range info.Deps {
+			// check if the module is replaced
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+
+			packages = append(packages, goPackage(name, dep.Path, dep.Version))
+		}
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].PURL != packages[j].PURL {
+			return packages[i].PURL < packages[j].PURL
+		}
+
+		return packages[i].Location < packages[j].Location
+	})
+
+	return packages
+}
+
+// distro returns the identifier for the operating system from the os-release file.
+func (r *rootfs) distro() string {
+	for _, name := range []string{"etc/os-release", "usr/lib/os-release"} {
+		scanner := bufio.NewScanner(bytes.NewReader(r.files[name]))
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+
+			if strings.HasPrefix(line, "ID=") {
+				return strings.Trim(strings.TrimPrefix(line, "ID="), `"'`)
+			}
+		}
+	}
+
+	return ""
+}
+
+// apkPackages parses the packages from the Alpine package database.
+func apkPackages(location, distro string, data []byte) []*sbomPackage {
+	// variable to store the packages
+	var packages []*sbomPackage
+
+	for _, stanza := range stanzas(data) {
+		// variable to store the package from the stanza
+		p := &sbomPackage{Location: location, Type: "apk"}
+
+		for _, line := range stanza {
+			// check if the line is a field
+			if len(line) < 2 || line[1] != ':' {
+				continue
+			}
+
+			switch line[0] {
+			case 'P':
+				p.Name = line[2:]
+			case 'V':
+				p.Version = line[2:]
+			case 'A':
+				p.Arch = line[2:]
+			}
+		}
+
+		// check if the stanza is a package
+		if len(p.Name) == 0 {
+			continue
+		}
+
+		p.PURL = purl("apk", distro, p.Name, p.Version, p.Arch)
+
+		packages = append(packages, p)
+	}
+
+	return packages
+}
+
+// dpkgPackages parses the installed packages from the Debian package database.
+func dpkgPackages(location, distro string, data []byte) []*sbomPackage {
+	// variable to store the packages
+	var packages []*sbomPackage
+
+	for _, stanza := range stanzas(data) {
+		// variable to store the package from the stanza
+		p := &sbomPackage{Location: location, Type: "deb"}
+
+		// variable to store the status of the package
+		status := ""
+
+		for _, line := range stanza {
+			key, value, ok := strings.Cut(line, ":")
+
+			// skip continuation lines for multi-line fields
+			if !ok || strings.HasPrefix(line, " ") {
+				continue
+			}
+
+			value = strings.TrimSpace(value)
+
+			switch key {
+			case "Package":
+				p.Name = value
+			case "Version":
+				p.Version = value
+			case "Architecture":
+				p.Arch = value
+			case "Status":
+				status = value
+			}
+		}
+
+		// check if the stanza is an installed package
+		if len(p.Name) == 0 || (len(status) > 0 && !strings.HasSuffix(status, " installed")) {
+			continue
+		}
+
+		p.PURL = purl("deb", distro, p.Name, p.Version, p.Arch)
+
+		packages = append(packages, p)
+	}
+
+	return packages
+}
+
+// goPackage creates the package for the Go module found in the executable.
+func goPackage(location, module, version string) *sbomPackage {
+	// remove the version for modules built from source
+	if version == "(devel)" {
+		version = ""
+	}
+
+	return &sbomPackage{
+		Location: location,
+		Name:     module,
+		PURL:     purl("golang", "", module, version, ""),
+		Type:     "golang",
+		Version:  version,
+	}
+}
+
+// stanzas splits the package database into the blocks of
+// lines for each package separated by an empty line.
+func stanzas(data []byte) [][]string {
+	// variable to store the stanzas
+	var blocks [][]string
+
+	// variable to store the lines for the current stanza
+	var block []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxDatabase)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		// check if the stanza ended
+		if len(strings.TrimSpace(line)) == 0 {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+			}
+
+			block = nil
+
+			continue
+		}
+
+		block = append(block, line)
+	}
+
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// purl formats the package URL for the package.
+func purl(kind, namespace, name, version, arch string) string {
+	// variable to store the package URL
+	var b strings.Builder
+
+	b.WriteString("pkg:")
+	b.WriteString(kind)
+	b.WriteString("/")
+
+	// check if a namespace is provided
+	if len(namespace) > 0 {
+		b.WriteString(purlEscape(namespace))
+		b.WriteString("/")
+	}
+
+	// escape each segment of the name while keeping the separators
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = purlEscape(segment)
+	}
+
+	b.WriteString(strings.Join(segments, "/"))
+
+	// check if a version is provided
+	if len(version) > 0 {
+		b.WriteString("@")
+		b.WriteString(purlEscape(version))
+	}
+
+	// check if an architecture is provided
+	if len(arch) > 0 {
+		b.WriteString("?arch=")
+		b.WriteString(url.QueryEscape(arch))
+	}
+
+	return b.String()
+}
+
+// purlEscape percent-encodes the segment for the package URL
+// including the plus sign which is reserved by the specification.
+func purlEscape(segment string) string {
+	return strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	u := make([]byte, 16)
+
+	_, _ = rand.Read(u)
+
+	// set the version and variant for the UUID
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// spdxDocument represents a software bill of materials in the SPDX 2.3 JSON format.
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+// spdxCreationInfo represents the creation information for an SPDX document.
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+// spdxPackage represents a package in an SPDX document.
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+// spdxExternalRef represents a reference to a package in an SPDX document.
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+// spdxRelationship represents a relationship between elements in an SPDX document.
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// newSPDX creates the SPDX document for the image and packages.
+func newSPDX(name, digest string, packages []*sbomPackage) *spdxDocument {
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://go-vela.github.io/vela-img/spdx/%s-%s", slug(name), newUUID()),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: vela-img"},
+		},
+		Packages: []spdxPackage{{
+			Name:             name,
+			SPDXID:           "SPDXRef-Image",
+			VersionInfo:      digest,
+			DownloadLocation: "NOASSERTION",
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: "SPDXRef-Image",
+		}},
+	}
+
+	for i, p := range packages {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             p.Name,
+			SPDXID:           id,
+			VersionInfo:      p.Version,
+			DownloadLocation: "NOASSERTION",
+			SourceInfo:       fmt.Sprintf("found in %s", p.Location),
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  p.PURL,
+			}},
+		})
+
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-Image",
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return doc
+}
+
+// cdxDocument represents a software bill of materials in the CycloneDX 1.4 JSON format.
+type cdxDocument struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+// cdxMetadata represents the metadata for a CycloneDX document.
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+// cdxTool represents the tool creating a CycloneDX document.
+type cdxTool struct {
+	Vendor string `json:"vendor"`
+	Name   string `json:"name"`
+}
+
+// cdxComponent represents a component in a CycloneDX document.
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+// cdxProperty represents a property for a component in a CycloneDX document.
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// newCycloneDX creates the CycloneDX document for the image and packages.
+func newCycloneDX(name, digest string, packages []*sbomPackage) *cdxDocument {
+	doc := &cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: fmt.Sprintf("urn:uuid:%s", newUUID()),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Vendor: "go-vela", Name: "vela-img"}},
+			Component: cdxComponent{
+				BOMRef:  "image",
+				Type:    "container",
+				Name:    name,
+				Version: digest,
+			},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for i, p := range packages {
+		doc.Components = append(doc.Components, cdxComponent{
+			BOMRef:  fmt.Sprintf("package-%d", i+1),
+			Type:    "library",
+			Name:    p.Name,
+			Version: p.Version,
+			PURL:    p.PURL,
+			Properties: []cdxProperty{{
+				Name:  "vela-img:location",
+				Value: p.Location,
+			}},
+		})
+	}
+
+	return doc
+}
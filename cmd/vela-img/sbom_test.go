@@ -0,0 +1,302 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"debug/buildinfo"
+	"encoding/json"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestImg_Build_sbomFile(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build *Build
+		want  string
+	}{
+		{build: &Build{SBOM: sbomSPDX}, want: "sbom.spdx.json"},
+		{build: &Build{SBOM: sbomCycloneDX}, want: "sbom.cdx.json"},
+		{build: &Build{SBOM: sbomSPDX, SBOMFile: "out/image.json"}, want: "out/image.json"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := test.build.sbomFile()
+
+		if got != test.want {
+			t.Errorf("sbomFile is %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestImg_Build_validateSBOM(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		build   *Build
+		failure bool
+	}{
+		{build: &Build{}},
+		{build: &Build{SBOM: sbomSPDX}},
+		{build: &Build{SBOM: sbomCycloneDX, Output: "type=oci,dest=image.tar"}},
+		{build: &Build{SBOM: sbomSPDX, Output: "type=local,dest=out"}},
+		{build: &Build{SBOM: "syft"}, failure: true},
+		{build: &Build{SBOM: sbomSPDX, Output: "type=image,name=foo"}, failure: true},
+		{build: &Build{SBOM: sbomSPDX, Platforms: []string{"linux/amd64"}}},
+		{build: &Build{SBOM: sbomSPDX, Platforms: []string{"linux/amd64", "linux/arm64"}}, failure: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		err := test.build.validateSBOM()
+
+		if test.failure {
+			if err == nil {
+				t.Errorf("validateSBOM for %s should have returned err", test.build.SBOM)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("validateSBOM for %s returned err: %v", test.build.SBOM, err)
+		}
+	}
+}
+
+func TestImg_Build_Exec_SBOM(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	_ = afero.WriteFile(appFS, "out/etc/os-release", []byte("NAME=\"Alpine Linux\"\nID=alpine\n"), 0644)
+	_ = afero.WriteFile(appFS, "out/lib/apk/db/installed", []byte("P:musl\nV:1.2.3-r4\nA:x86_64\n"), 0644)
+
+	// setup types
+	b := &Build{
+		Directory: ".",
+		Img:       &Img{Runner: new(fakeRunner)},
+		Output:    "type=local,dest=out",
+		SBOM:      sbomCycloneDX,
+		SBOMFile:  "reports/sbom.json",
+		Tags:      []string{"index.docker.io/target/vela-img:latest"},
+	}
+
+	err := b.Exec(context.Background())
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	data, err := afero.ReadFile(appFS, "reports/sbom.json")
+	if err != nil {
+		t.Errorf("unable to read sbom: %v", err)
+	}
+
+	doc := new(cdxDocument)
+
+	err = json.Unmarshal(data, doc)
+	if err != nil {
+		t.Errorf("unable to parse sbom: %v", err)
+	}
+
+	if len(doc.Components) != 1 || doc.Components[0].PURL != "pkg:apk/alpine/musl@1.2.3-r4?arch=x86_64" {
+		t.Errorf("Exec sbom components are %v, want musl", doc.Components)
+	}
+}
+
+func TestImg_Build_Exec_SBOMError(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	b := &Build{
+		Directory: ".",
+		Img:       &Img{Runner: new(fakeRunner)},
+		SBOM:      sbomSPDX,
+		Tags:      []string{"index.docker.io/target/vela-img:latest"},
+	}
+
+	// the saved archive is empty since the image is never built
+	err := b.Exec(context.Background())
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+
+	if len(b.archive) > 0 {
+		t.Errorf("Exec should have removed the archive %s", b.archive)
+	}
+}
+
+func TestImg_rootfs_packages(t *testing.T) {
+	// setup types
+	r := newRootfs()
+
+	r.files["etc/os-release"] = []byte("PRETTY_NAME=\"Debian GNU/Linux 12\"\nID=debian\n")
+	r.files["var/lib/dpkg/status"] = []byte(`Package: libc6
+Status: install ok installed
+Architecture: amd64
+Version: 2.36-9+deb12u3
+Description: GNU C Library
+ Contains the standard libraries.
+
+Package: removed
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+`)
+	r.files["var/lib/dpkg/status.d/base-files"] = []byte("Package: base-files\nArchitecture: amd64\nVersion: 12.4\n")
+	r.binaries["usr/bin/app"] = &buildinfo.BuildInfo{
+		Main: debug.Module{Path: "github.com/target/app", Version: "(devel)"},
+		Deps: []*debug.Module{
+			{Path: "github.com/sirupsen/logrus", Version: "v1.9.0"},
+			{Path: "golang.org/x/sys", Version: "v0.1.0", Replace: &debug.Module{Path: "github.com/fork/sys", Version: "v0.2.0"}},
+		},
+	}
+
+	want := []string{
+		"pkg:deb/debian/base-files@12.4?arch=amd64",
+		"pkg:deb/debian/libc6@2.36-9%2Bdeb12u3?arch=amd64",
+		"pkg:golang/github.com/fork/sys@v0.2.0",
+		"pkg:golang/github.com/sirupsen/logrus@v1.9.0",
+		"pkg:golang/github.com/target/app",
+	}
+
+	// run test
+	got := []string{}
+
+	for _, p := range r.packages() {
+		got = append(got, p.PURL)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("packages is %v, want %v", got, want)
+	}
+}
+
+func TestImg_rootfs_packages_RPM(t *testing.T) {
+	// setup types
+	r := newRootfs()
+
+	r.files["etc/os-release"] = []byte("ID=rhel\n")
+	r.files["usr/lib/sysimage/rpm/rpmdb.sqlite"] = testRPMDatabase(t, [][]byte{
+		testRPMHeader("bash", "5.1.8", "6.el9", "x86_64", 0),
+	})
+	r.files["var/lib/rpm/rpmdb.sqlite"] = []byte("SQLite format 3")
+	r.files["var/lib/rpm/Packages"] = []byte("BerkeleyDB")
+
+	want := []string{"pkg:rpm/rhel/bash@5.1.8-6.el9?arch=x86_64"}
+
+	// run test
+	got := []string{}
+
+	// the databases that can not be read are skipped
+	for _, p := range r.packages() {
+		got = append(got, p.PURL)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("packages is %v, want %v", got, want)
+	}
+}
+
+func TestImg_apkPackages(t *testing.T) {
+	// setup types
+	data := []byte(`C:Q1abc=
+P:musl
+V:1.2.3-r4
+A:x86_64
+L:MIT
+
+P:busybox
+V:1.36.1-r2
+A:x86_64
+`)
+
+	want := []*sbomPackage{
+		{Arch: "x86_64", Location: "lib/apk/db/installed", Name: "musl", PURL: "pkg:apk/alpine/musl@1.2.3-r4?arch=x86_64", Type: "apk", Version: "1.2.3-r4"},
+		{Arch: "x86_64", Location: "lib/apk/db/installed", Name: "busybox", PURL: "pkg:apk/alpine/busybox@1.36.1-r2?arch=x86_64", Type: "apk", Version: "1.36.1-r2"},
+	}
+
+	// run test
+	got := apkPackages("lib/apk/db/installed", "alpine", data)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("apkPackages is %v, want %v", got, want)
+	}
+}
+
+func TestImg_purl(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		kind, namespace, name, version, arch string
+		want                                 string
+	}{
+		{kind: "apk", namespace: "alpine", name: "musl", version: "1.2.3-r4", arch: "x86_64", want: "pkg:apk/alpine/musl@1.2.3-r4?arch=x86_64"},
+		{kind: "deb", name: "libc6", version: "1:2.36", want: "pkg:deb/libc6@1:2.36"},
+		{kind: "golang", name: "github.com/go-vela/vela-img", version: "v0.1.0", want: "pkg:golang/github.com/go-vela/vela-img@v0.1.0"},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got := purl(test.kind, test.namespace, test.name, test.version, test.arch)
+
+		if got != test.want {
+			t.Errorf("purl is %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestImg_newSPDX(t *testing.T) {
+	// setup types
+	packages := []*sbomPackage{
+		{Location: "lib/apk/db/installed", Name: "musl", PURL: "pkg:apk/alpine/musl@1.2.3-r4", Version: "1.2.3-r4"},
+	}
+
+	// run test
+	got := newSPDX("target/vela-img:latest", "sha256:abc123", packages)
+
+	if got.SPDXVersion != "SPDX-2.3" || !strings.HasPrefix(got.DocumentNamespace, "https://") {
+		t.Errorf("newSPDX document is %v, want SPDX-2.3 with namespace", got)
+	}
+
+	if len(got.Packages) != 2 || got.Packages[1].ExternalRefs[0].ReferenceLocator != packages[0].PURL {
+		t.Errorf("newSPDX packages are %v, want image and musl", got.Packages)
+	}
+
+	want := []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Image"},
+		{SPDXElementID: "SPDXRef-Image", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-1"},
+	}
+
+	if !reflect.DeepEqual(got.Relationships, want) {
+		t.Errorf("newSPDX relationships are %v, want %v", got.Relationships, want)
+	}
+}
+
+func TestImg_newCycloneDX(t *testing.T) {
+	// setup types
+	packages := []*sbomPackage{
+		{Location: "lib/apk/db/installed", Name: "musl", PURL: "pkg:apk/alpine/musl@1.2.3-r4", Version: "1.2.3-r4"},
+	}
+
+	// run test
+	got := newCycloneDX("target/vela-img:latest", "sha256:abc123", packages)
+
+	if got.SpecVersion != "1.4" || !strings.HasPrefix(got.SerialNumber, "urn:uuid:") {
+		t.Errorf("newCycloneDX document is %v, want 1.4 with serial number", got)
+	}
+
+	if got.Metadata.Component.Type != "container" || got.Metadata.Component.Version != "sha256:abc123" {
+		t.Errorf("newCycloneDX component is %v, want container", got.Metadata.Component)
+	}
+
+	if len(got.Components) != 1 || got.Components[0].PURL != packages[0].PURL {
+		t.Errorf("newCycloneDX components are %v, want musl", got.Components)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// secret represents a secret mounted into the build
+// with the 'RUN --mount=type=secret' instruction.
+type secret struct {
+	// ID should be the identifier used to mount the secret
+	ID string
+	// Source should be the environment variable or absolute file path providing the secret
+	Source string
+
+	// file provided to img for the secret
+	src string
+	// contents of the secret sourced from an environment variable
+	value string
+	// indicates the file was created for the secret
+	temp bool
+}
+
+// parseSecret creates a secret from the provided
+// input in the 'id=source' format.
+func parseSecret(input string) (*secret, error) {
+	parts := strings.SplitN(input, "=", 2)
+
+	// verify both the id and source are provided
+	if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+		return nil, fmt.Errorf("invalid build secret provided: %s", input)
+	}
+
+	return &secret{
+		ID:     strings.TrimSpace(parts[0]),
+		Source: strings.TrimSpace(parts[1]),
+	}, nil
+}
+
+// isFile checks if the secret is sourced from a file.
+func (s *secret) isFile() bool {
+	return filepath.IsAbs(s.Source)
+}
+
+// Flag formats the secret as a flag for the build command.
+func (s *secret) Flag() string {
+	return fmt.Sprintf("--secret=id=%s,src=%s", s.ID, s.src)
+}
+
+// Mount prepares the file provided to img for the secret. Secrets sourced
+// from an environment variable are written to a temporary file.
+func (s *secret) Mount() error {
+	logrus.Tracef("mounting build secret %s", s.ID)
+
+	// use custom filesystem which enables us to test
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// check if the secret is sourced from a file
+	if s.isFile() {
+		exists, err := a.Exists(s.Source)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return fmt.Errorf("no file found for build secret %s: %s", s.ID, s.Source)
+		}
+
+		s.src = s.Source
+
+		return nil
+	}
+
+	value, ok := os.LookupEnv(s.Source)
+	if !ok {
+		return fmt.Errorf("no environment variable found for build secret %s: %s", s.ID, s.Source)
+	}
+
+	f, err := a.TempFile("", "vela-img-secret-")
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	s.src = f.Name()
+	s.temp = true
+	s.value = value
+
+	err = a.Chmod(s.src, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(value)
+
+	return err
+}
+
+// Unmount removes the temporary file created for the secret.
+func (s *secret) Unmount() error {
+	logrus.Tracef("unmounting build secret %s", s.ID)
+
+	// check if a temporary file was created for the secret
+	if !s.temp {
+		return nil
+	}
+
+	s.temp = false
+
+	return appFS.Remove(s.src)
+}
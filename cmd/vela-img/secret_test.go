@@ -0,0 +1,145 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestImg_parseSecret(t *testing.T) {
+	// setup tests
+	tests := []struct {
+		input   string
+		want    *secret
+		wantErr bool
+	}{
+		{input: "npmrc=/vela/secrets/npmrc", want: &secret{ID: "npmrc", Source: "/vela/secrets/npmrc"}},
+		{input: "token=GITHUB_TOKEN", want: &secret{ID: "token", Source: "GITHUB_TOKEN"}},
+		{input: "token", wantErr: true},
+		{input: "=GITHUB_TOKEN", wantErr: true},
+		{input: "token=", wantErr: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		got, err := parseSecret(test.input)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseSecret should have returned err for %s", test.input)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseSecret returned err for %s: %v", test.input, err)
+		}
+
+		if got.ID != test.want.ID || got.Source != test.want.Source {
+			t.Errorf("parseSecret is %v, want %v", got, test.want)
+		}
+	}
+}
+
+func TestImg_secret_Mount_Env(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	t.Setenv("GITHUB_TOKEN", "superSecretToken")
+
+	// setup types
+	s := &secret{
+		ID:     "token",
+		Source: "GITHUB_TOKEN",
+	}
+
+	err := s.Mount()
+	if err != nil {
+		t.Errorf("Mount returned err: %v", err)
+	}
+
+	data, err := a.ReadFile(s.src)
+	if err != nil {
+		t.Errorf("unable to read secret file: %v", err)
+	}
+
+	if string(data) != "superSecretToken" {
+		t.Errorf("secret file is %s, want %s", data, "superSecretToken")
+	}
+
+	err = s.Unmount()
+	if err != nil {
+		t.Errorf("Unmount returned err: %v", err)
+	}
+
+	exists, _ := a.Exists(s.src)
+	if exists {
+		t.Errorf("secret file %s should have been removed", s.src)
+	}
+}
+
+func TestImg_secret_Mount_File(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	a := &afero.Afero{
+		Fs: appFS,
+	}
+
+	// setup types
+	s := &secret{
+		ID:     "npmrc",
+		Source: "/vela/secrets/npmrc",
+	}
+
+	err := s.Mount()
+	if err == nil {
+		t.Errorf("Mount should have returned err")
+	}
+
+	_ = a.WriteFile("/vela/secrets/npmrc", []byte("//registry.npmjs.org/:_authToken=foo"), 0600)
+
+	err = s.Mount()
+	if err != nil {
+		t.Errorf("Mount returned err: %v", err)
+	}
+
+	if s.Flag() != "--secret=id=npmrc,src=/vela/secrets/npmrc" {
+		t.Errorf("Flag is %s", s.Flag())
+	}
+
+	err = s.Unmount()
+	if err != nil {
+		t.Errorf("Unmount returned err: %v", err)
+	}
+
+	exists, _ := a.Exists(s.Source)
+	if !exists {
+		t.Errorf("secret file %s should not have been removed", s.Source)
+	}
+}
+
+func TestImg_secret_Mount_NoEnv(t *testing.T) {
+	// setup filesystem
+	appFS = afero.NewMemMapFs()
+
+	// setup types
+	s := &secret{
+		ID:     "token",
+		Source: "VELA_IMG_MISSING_SECRET",
+	}
+
+	err := s.Mount()
+	if err == nil {
+		t.Errorf("Mount should have returned err")
+	}
+}
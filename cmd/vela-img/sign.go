@@ -0,0 +1,439 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// mediaConfig is the media type for the config of the signature image.
+	mediaConfig = "application/vnd.oci.image.config.v1+json"
+	// mediaSignature is the media type for the payload signed by cosign.
+	mediaSignature = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// annotationSignature is the annotation storing the signature for the payload.
+	annotationSignature = "dev.cosignproject.cosign/signature"
+	// signatureType is the type of the payload signed by cosign.
+	signatureType = "cosign container image signature"
+)
+
+// Sign represents the plugin configuration for signing images.
+type Sign struct {
+	// private key in the PEM format signing the images
+	Key string
+	// password decrypting the private key
+	Password string
+
+	// signer created from the private key
+	signer crypto.Signer
+}
+
+// signFlags represents for sign settings on the cli.
+var signFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "sign.key",
+		Usage:    "should be the private key in the PEM format signing the pushed images (e.g. a cosign key)",
+		EnvVars:  []string{"PARAMETER_SIGNING_KEY", "SIGNING_KEY"},
+		FilePath: string("/vela/parameters/img/sign/key,/vela/secrets/img/sign/key,/vela/secrets/img/signing_key"),
+	},
+	&cli.StringFlag{
+		Name:     "sign.password",
+		Usage:    "should be the password decrypting the private key",
+		EnvVars:  []string{"PARAMETER_SIGNING_PASSWORD", "SIGNING_PASSWORD", "COSIGN_PASSWORD"},
+		FilePath: string("/vela/parameters/img/sign/password,/vela/secrets/img/sign/password,/vela/secrets/img/signing_password"),
+	},
+}
+
+// payload represents the simple signing payload signed by cosign.
+type payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// signatureConfig represents the config for the signature image.
+type signatureConfig struct {
+	Architecture string             `json:"architecture"`
+	Created      string             `json:"created"`
+	History      []signatureHistory `json:"history"`
+	OS           string             `json:"os"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	Config struct{} `json:"config"`
+}
+
+// envelope represents a signed DSSE envelope.
+type envelope struct {
+	PayloadType string              `json:"payloadType"`
+	Payload     string              `json:"payload"`
+	Signatures  []envelopeSignature `json:"signatures"`
+}
+
+// envelopeSignature represents a signature in a DSSE envelope.
+type envelopeSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// signatureHistory represents the history for a layer of the signature image.
+type signatureHistory struct {
+	Created string `json:"created"`
+}
+
+// Enabled checks if a private key is provided for signing the images.
+func (s *Sign) Enabled() bool {
+	return s != nil && len(s.Key) > 0
+}
+
+// Exec signs the digest for the image from the Build and uploads
+// the signature to every repository the image was pushed to.
+func (s *Sign) Exec(ctx context.Context, c *Config, b *Build) error {
+	logrus.Trace("running sign with provided configuration")
+
+	// check if a signer is created
+	if s.signer == nil {
+		err := s.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	// verify the digest is captured for the image
+	if len(b.digest) == 0 {
+		return fmt.Errorf("no digest captured for image %s", b.Name())
+	}
+
+	for _, ref := range b.references() {
+		logrus.Infof("signing image %s@%s", ref, b.digest)
+
+		tag, err := s.sign(ctx, newRegistryClient(c, ref), b.digest)
+		if err != nil {
+			return fmt.Errorf("unable to sign image %s: %w", ref, err)
+		}
+
+		signature := fmt.Sprintf("%s:%s", ref, tag)
+
+		if !contains(b.signatures, signature) {
+			b.signatures = append(b.signatures, signature)
+		}
+	}
+
+	return nil
+}
+
+// Print outputs the images signed for the Build without signing them.
+func (s *Sign) Print(b *Build) {
+	for _, ref := range b.references() {
+		logrus.Infof("image %s would be signed", ref)
+	}
+}
+
+// Validate verifies the Sign is properly configured.
+func (s *Sign) Validate() error {
+	logrus.Trace("validating sign plugin configuration")
+
+	signer, err := parseSigningKey(s.Key, s.Password)
+	if err != nil {
+		return err
+	}
+
+	s.signer = signer
+
+	return nil
+}
+
+// references returns the repositories the image from the Build is pushed to.
+func (b *Build) references() []*reference {
+	// variable to store the repositories
+	var refs []*reference
+
+	// variable to store the names of the repositories
+	var names []string
+
+	for _, tag := range b.AllTags() {
+		ref := parseReference(tag)
+
+		if contains(names, ref.String()) {
+			continue
+		}
+
+		names = append(names, ref.String())
+		refs = append(refs, ref)
+	}
+
+	return refs
+}
+
+// sign uploads the signature for the digest to the repository
+// in the format used by cosign and returns the signature tag.
+func (s *Sign) sign(ctx context.Context, r *registryClient, digest string) (string, error) {
+	// variable to store the payload signed for the image
+	p := new(payload)
+
+	p.Critical.Identity.DockerReference = r.ref.String()
+	p.Critical.Image.DockerManifestDigest = digest
+	p.Critical.Type = signatureType
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signPayload(s.signer, data)
+	if err != nil {
+		return "", err
+	}
+
+	// the signatures are stored in a tag derived from the digest
+	tag := fmt.Sprintf("%s.sig", strings.Replace(digest, ":", "-", 1))
+
+	layer, err := r.PutBlob(ctx, mediaSignature, data)
+	if err != nil {
+		return "", err
+	}
+
+	layer.Annotations = map[string]string{
+		annotationSignature: base64.StdEncoding.EncodeToString(signature),
+	}
+
+	// add the signature to the signatures that already exist
+	m, err := r.Manifest(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+
+	if m == nil {
+		m = &manifest{SchemaVersion: 2, MediaType: mediaManifest}
+	}
+
+	// check if the payload was already signed with the key by a previous attempt
+	for _, l := range m.Layers {
+		if l.Digest != layer.Digest {
+			continue
+		}
+
+		existing, err := base64.StdEncoding.DecodeString(l.Annotations[annotationSignature])
+		if err != nil {
+			continue
+		}
+
+		if verifyPayload(s.signer.Public(), data, existing) {
+			return tag, nil
+		}
+	}
+
+	m.Layers = append(m.Layers, layer)
+
+	// variable to store the config for the signature image
+	config := new(signatureConfig)
+
+	config.Created = "0001-01-01T00:00:00Z"
+	config.RootFS.Type = "layers"
+
+	for _, l := range m.Layers {
+		config.History = append(config.History, signatureHistory{Created: config.Created})
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, l.Digest)
+	}
+
+	data, err = json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	m.Config, err = r.PutBlob(ctx, mediaConfig, data)
+	if err != nil {
+		return "", err
+	}
+
+	return tag, r.PutManifest(ctx, tag, m)
+}
+
+// Envelope signs the payload and returns the DSSE envelope.
+//
+// https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+func (s *Sign) Envelope(payloadType string, data []byte) ([]byte, error) {
+	// check if a signer is created
+	if s.signer == nil {
+		err := s.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// sign the pre-authentication encoding for the payload
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(data), data)
+
+	signature, err := signPayload(s.signer, []byte(pae))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&envelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(data),
+		Signatures: []envelopeSignature{{
+			Sig: base64.StdEncoding.EncodeToString(signature),
+		}},
+	})
+}
+
+// signPayload signs the payload with the private key.
+func signPayload(signer crypto.Signer, data []byte) ([]byte, error) {
+	// check if the private key signs the payload without hashing
+	if _, ok := signer.(ed25519.PrivateKey); ok {
+		return signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+
+	digest := sha256.Sum256(data)
+
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// verifyPayload checks if the signature for the payload is valid for the public key.
+func verifyPayload(public crypto.PublicKey, data, signature []byte) bool {
+	digest := sha256.Sum256(data)
+
+	switch key := public.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
+
+// parseSigningKey parses the private key in the PEM format
+// including private keys encrypted by cosign with the password.
+func parseSigningKey(key, password string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in signing key")
+	}
+
+	// variable to store the parsed private key
+	var parsed interface{}
+
+	var err error
+
+	switch block.Type {
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		var der []byte
+
+		der, err = decryptKey(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err = x509.ParsePKCS8PrivateKey(der)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported signing key type: %s", block.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing key: %w", err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing key: %T", parsed)
+	}
+
+	return signer, nil
+}
+
+// encryptedKey represents a private key encrypted by cosign.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// decryptKey decrypts the private key encrypted by cosign using
+// a key derived from the password with scrypt and nacl/secretbox.
+func decryptKey(data []byte, password string) ([]byte, error) {
+	// variable to store the encrypted private key
+	enc := new(encryptedKey)
+
+	err := json.Unmarshal(data, enc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse encrypted signing key: %w", err)
+	}
+
+	// verify the key derivation and cipher are supported
+	if enc.KDF.Name != "scrypt" || enc.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("unsupported signing key encryption: %s with %s", enc.KDF.Name, enc.Cipher.Name)
+	}
+
+	// verify the nonce is the size required by secretbox
+	if len(enc.Cipher.Nonce) != 24 {
+		return nil, fmt.Errorf("invalid nonce for encrypted signing key")
+	}
+
+	derived, err := scrypt.Key([]byte(password), enc.KDF.Salt, enc.KDF.Params.N, enc.KDF.Params.R, enc.KDF.Params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key for signing key: %w", err)
+	}
+
+	var (
+		key   [32]byte
+		nonce [24]byte
+	)
+
+	copy(key[:], derived)
+	copy(nonce[:], enc.Cipher.Nonce)
+
+	der, ok := secretbox.Open(nil, enc.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, fmt.Errorf("unable to decrypt signing key: invalid password")
+	}
+
+	return der, nil
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// testSigningKey creates a private key encrypted with the
+// password in the format used by cosign and the public key.
+func testSigningKey(t *testing.T, password string) (string, *ecdsa.PublicKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %v", err)
+	}
+
+	enc := new(encryptedKey)
+
+	enc.KDF.Name = "scrypt"
+	enc.KDF.Params.N = 1024
+	enc.KDF.Params.R = 8
+	enc.KDF.Params.P = 1
+	enc.KDF.Salt = make([]byte, 32)
+	enc.Cipher.Name = "nacl/secretbox"
+	enc.Cipher.Nonce = make([]byte, 24)
+
+	_, _ = rand.Read(enc.KDF.Salt)
+	_, _ = rand.Read(enc.Cipher.Nonce)
+
+	derived, err := scrypt.Key([]byte(password), enc.KDF.Salt, 1024, 8, 1, 32)
+	if err != nil {
+		t.Fatalf("unable to derive key: %v", err)
+	}
+
+	var (
+		secret [32]byte
+		nonce  [24]byte
+	)
+
+	copy(secret[:], derived)
+	copy(nonce[:], enc.Cipher.Nonce)
+
+	enc.Ciphertext = secretbox.Seal(nil, der, &nonce, &secret)
+
+	data, err := json.Marshal(enc)
+	if err != nil {
+		t.Fatalf("unable to marshal encrypted key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: data})), &key.PublicKey
+}
+
+func TestImg_parseSigningKey(t *testing.T) {
+	// setup types
+	encrypted, _ := testSigningKey(t, "superSecretPassword")
+
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+
+	// setup tests
+	tests := []struct {
+		name     string
+		key      string
+		password string
+		failure  bool
+	}{
+		{name: "encrypted", key: encrypted, password: "superSecretPassword"},
+		{name: "wrong password", key: encrypted, password: "wrongPassword", failure: true},
+		{name: "pkcs8", key: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))},
+		{name: "public key", key: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), failure: true},
+		{name: "invalid", key: "not a key", failure: true},
+	}
+
+	// run tests
+	for _, test := range tests {
+		_, err := parseSigningKey(test.key, test.password)
+
+		if test.failure {
+			if err == nil {
+				t.Errorf("parseSigningKey for %s should have returned err", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseSigningKey for %s returned err: %v", test.name, err)
+		}
+	}
+}
+
+func TestImg_Sign_Exec(t *testing.T) {
+	// setup types
+	registry := newTestRegistry(t)
+
+	key, public := testSigningKey(t, "superSecretPassword")
+
+	s := &Sign{
+		Key:      key,
+		Password: "superSecretPassword",
+	}
+
+	b := &Build{
+		Tags:   []string{registry.host() + "/target/vela-img:latest", registry.host() + "/target/vela-img:v1"},
+		digest: "sha256:abc123",
+	}
+
+	// run test
+	for i := 0; i < 2; i++ {
+		err := s.Exec(context.Background(), registry.config(), b)
+		if err != nil {
+			t.Errorf("Exec returned err: %v", err)
+		}
+	}
+
+	want := registry.host() + "/target/vela-img:sha256-abc123.sig"
+
+	if len(b.signatures) != 1 || b.signatures[0] != want {
+		t.Errorf("Exec signatures are %v, want %s", b.signatures, want)
+	}
+
+	m := registry.manifest("target/vela-img", "sha256-abc123.sig")
+	if m == nil {
+		t.Fatalf("Exec should have uploaded the signature manifest")
+	}
+
+	// the signature is not added again when the sign is retried
+	if len(m.Layers) != 1 {
+		t.Errorf("Exec signature layers are %d, want 1", len(m.Layers))
+	}
+
+	layer := m.Layers[0]
+
+	data := registry.blobs[layer.Digest]
+
+	if !strings.Contains(string(data), `"docker-manifest-digest":"sha256:abc123"`) {
+		t.Errorf("Exec payload is %s, want digest sha256:abc123", data)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[annotationSignature])
+	if err != nil {
+		t.Errorf("unable to decode signature: %v", err)
+	}
+
+	digest := sha256.Sum256(data)
+
+	if !ecdsa.VerifyASN1(public, digest[:], signature) {
+		t.Errorf("Exec signature is not valid for the payload")
+	}
+
+	if _, ok := registry.blobs[m.Config.Digest]; !ok {
+		t.Errorf("Exec should have uploaded the signature config")
+	}
+}
+
+func TestImg_Sign_Exec_Keys(t *testing.T) {
+	// setup types
+	registry := newTestRegistry(t)
+
+	b := &Build{
+		Tags:   []string{registry.host() + "/target/vela-img:latest"},
+		digest: "sha256:abc123",
+	}
+
+	// variable to store the signers with different keys
+	var signers []*Sign
+
+	for i := 0; i < 2; i++ {
+		key, _ := testSigningKey(t, "superSecretPassword")
+
+		signers = append(signers, &Sign{Key: key, Password: "superSecretPassword"})
+	}
+
+	// run test
+	for _, s := range append(signers, signers[0]) {
+		err := s.Exec(context.Background(), registry.config(), b)
+		if err != nil {
+			t.Errorf("Exec returned err: %v", err)
+		}
+	}
+
+	m := registry.manifest("target/vela-img", "sha256-abc123.sig")
+	if m == nil {
+		t.Fatalf("Exec should have uploaded the signature manifest")
+	}
+
+	// the signature from each key is added to the existing signatures
+	if len(m.Layers) != 2 {
+		t.Errorf("Exec signature layers are %d, want 2", len(m.Layers))
+	}
+}
+
+func TestImg_verifyPayload(t *testing.T) {
+	// setup types
+	data := []byte("hello")
+
+	_, ed, _ := ed25519.GenerateKey(rand.Reader)
+
+	ec, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	rs, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// run tests
+	for _, signer := range []crypto.Signer{ed, ec, rs} {
+		signature, err := signPayload(signer, data)
+		if err != nil {
+			t.Errorf("signPayload for %T returned err: %v", signer, err)
+		}
+
+		if !verifyPayload(signer.Public(), data, signature) {
+			t.Errorf("verifyPayload for %T should be valid", signer)
+		}
+
+		if verifyPayload(other.Public(), data, signature) {
+			t.Errorf("verifyPayload for %T should not be valid for another key", signer)
+		}
+	}
+}
+
+func TestImg_Sign_Envelope(t *testing.T) {
+	// setup types
+	key, public := testSigningKey(t, "superSecretPassword")
+
+	s := &Sign{
+		Key:      key,
+		Password: "superSecretPassword",
+	}
+
+	// run test
+	data, err := s.Envelope(mediaInToto, []byte(`{"_type":"test"}`))
+	if err != nil {
+		t.Errorf("Envelope returned err: %v", err)
+	}
+
+	e := new(envelope)
+
+	err = json.Unmarshal(data, e)
+	if err != nil {
+		t.Errorf("unable to unmarshal envelope: %v", err)
+	}
+
+	if e.PayloadType != mediaInToto {
+		t.Errorf("Envelope payload type is %s, want %s", e.PayloadType, mediaInToto)
+	}
+
+	if len(e.Signatures) != 1 {
+		t.Fatalf("Envelope signatures are %d, want 1", len(e.Signatures))
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(e.Signatures[0].Sig)
+	if err != nil {
+		t.Errorf("unable to decode signature: %v", err)
+	}
+
+	// the signature is for the pre-authentication encoding
+	digest := sha256.Sum256([]byte(`DSSEv1 28 application/vnd.in-toto+json 16 {"_type":"test"}`))
+
+	if !ecdsa.VerifyASN1(public, digest[:], signature) {
+		t.Errorf("Envelope signature is not valid for the payload")
+	}
+}
+
+func TestImg_Sign_Exec_NoDigest(t *testing.T) {
+	// setup types
+	key, _ := testSigningKey(t, "superSecretPassword")
+
+	s := &Sign{
+		Key:      key,
+		Password: "superSecretPassword",
+	}
+
+	b := &Build{
+		Tags: []string{"index.docker.io/target/vela-img:latest"},
+	}
+
+	// run test
+	err := s.Exec(context.Background(), new(Config), b)
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+}
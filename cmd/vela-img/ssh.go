@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshAgent represents an in-process SSH agent serving a private
+// key to the build with the 'RUN --mount=type=ssh' instruction.
+type sshAgent struct {
+	// directory containing the socket for the agent
+	dir string
+	// keyring holding the private key for the agent
+	keyring agent.Agent
+	// listener accepting connections on the socket for the agent
+	listener net.Listener
+}
+
+// parseKey verifies the provided private key can be parsed.
+func parseKey(key string) (interface{}, error) {
+	raw, err := ssh.ParseRawPrivateKey([]byte(key))
+	if err != nil {
+		// avoid including the key material in the error
+		return nil, fmt.Errorf("invalid build ssh key provided")
+	}
+
+	return raw, nil
+}
+
+// startAgent creates an SSH agent holding the provided
+// private key and listening on a temporary unix socket.
+func startAgent(key string) (*sshAgent, error) {
+	logrus.Trace("starting ssh agent for build")
+
+	raw, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := agent.NewKeyring()
+
+	err = keyring.Add(agent.AddedKey{PrivateKey: raw})
+	if err != nil {
+		return nil, fmt.Errorf("unable to add build ssh key to agent: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "vela-img-ssh-")
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+
+		return nil, fmt.Errorf("unable to create ssh agent socket: %w", err)
+	}
+
+	a := &sshAgent{
+		dir:      dir,
+		keyring:  keyring,
+		listener: listener,
+	}
+
+	go a.serve()
+
+	return a, nil
+}
+
+// Socket returns the path to the socket for the agent.
+func (a *sshAgent) Socket() string {
+	return a.listener.Addr().String()
+}
+
+// serve handles connections to the agent until the listener is closed.
+func (a *sshAgent) serve() {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.Warnf("unable to accept ssh agent connection: %v", err)
+			}
+
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			_ = agent.ServeAgent(a.keyring, conn)
+		}()
+	}
+}
+
+// Stop closes the agent and removes the key material.
+func (a *sshAgent) Stop() error {
+	logrus.Trace("stopping ssh agent for build")
+
+	err := a.listener.Close()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	err = a.keyring.RemoveAll()
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(a.dir)
+}
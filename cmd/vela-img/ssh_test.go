@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Target Brands, Inc. All rights reserved.
+//
+// Use of this source code is governed by the LICENSE file in this repository.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// testKey is a helper function to create a PEM encoded private key.
+func testKey(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestImg_startAgent(t *testing.T) {
+	a, err := startAgent(testKey(t))
+	if err != nil {
+		t.Fatalf("startAgent returned err: %v", err)
+	}
+
+	conn, err := net.Dial("unix", a.Socket())
+	if err != nil {
+		t.Fatalf("unable to connect to agent: %v", err)
+	}
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		t.Errorf("unable to list agent keys: %v", err)
+	}
+
+	if len(keys) != 1 {
+		t.Errorf("agent has %d keys, want 1", len(keys))
+	}
+
+	conn.Close()
+
+	err = a.Stop()
+	if err != nil {
+		t.Errorf("Stop returned err: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Dir(a.Socket()))
+	if !os.IsNotExist(err) {
+		t.Errorf("Stop should have removed agent socket %s", a.Socket())
+	}
+}
+
+func TestImg_startAgent_InvalidKey(t *testing.T) {
+	_, err := startAgent("not a key")
+	if err == nil {
+		t.Errorf("startAgent should have returned err")
+	}
+}